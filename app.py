@@ -1,21 +1,539 @@
-from fastapi import FastAPI, HTTPException, APIRouter
+from fastapi import FastAPI, HTTPException, APIRouter, WebSocket, WebSocketDisconnect, WebSocketException, Request, Response, Query, Depends, status
+from fastapi.requests import HTTPConnection
+from fastapi.encoders import jsonable_encoder
+from fastapi.exceptions import RequestValidationError
+from fastapi.middleware.cors import CORSMiddleware
+from fastapi.middleware.httpsredirect import HTTPSRedirectMiddleware
+from fastapi.responses import JSONResponse
 from pydantic import BaseModel
+from starlette.exceptions import HTTPException as StarletteHTTPException
+from typing import Any
 from prophet import Prophet
 from holidays import CountryHoliday
+from statsmodels.tsa.arima.model import ARIMA
+from statsmodels.tsa.holtwinters import ExponentialSmoothing
+from scipy.optimize import minimize
+from statistics import NormalDist
+from datetime import datetime, timezone
+from email.utils import format_datetime
+from http import HTTPStatus
+from collections import OrderedDict, deque
 import pandas as pd
+import numpy as np
+import itertools
+import base64
+import contextvars
+import secrets
+import copy
+import random
+import math
+import re
+import threading
+import hashlib
+import hmac
+import json
+import os
+import time
+import urllib.parse
+import urllib.request
+import uuid
+import warnings
 import logging
 import uvicorn
 import asyncio
 
-# Initialize logging to show only errors
-logging.basicConfig(level=logging.ERROR)
+# The ID of the current request, or of the request that submitted the current background job, for tracing
+current_request_id = contextvars.ContextVar("current_request_id", default="-")
+
+# Logging filter that adds the current request ID to every log record
+class RequestIDLogFilter(logging.Filter):
+    def filter(self, record):
+        record.request_id = current_request_id.get()
+        return True
+
+# Initialize logging to show only errors, tagged with the request ID
+logging.basicConfig(level=logging.ERROR, format="%(asctime)s %(levelname)s [%(request_id)s] %(name)s: %(message)s")
+for handler in logging.getLogger().handlers:
+    handler.addFilter(RequestIDLogFilter())
 logger = logging.getLogger(__name__)
 
-# Initialize the FastAPI app
-app = FastAPI()
+# Interactive API docs (Swagger UI and ReDoc) are only served in development, the OpenAPI document always is
+ENABLE_API_DOCS = os.environ.get("ENABLE_API_DOCS", "false").lower() == "true"
+
+# Initialize the FastAPI app. Operation IDs are the route function names, so generated clients get readable
+# method names such as predict_financials or get_prediction.
+app = FastAPI(
+    title="OptiVest Finance Predictor",
+    version="1.0.0",
+    description="Forecasting, portfolio analytics and financial planning projections for OptiVest.",
+    openapi_url="/openapi.json",
+    docs_url="/docs" if ENABLE_API_DOCS else None,
+    redoc_url="/redoc" if ENABLE_API_DOCS else None,
+    generate_unique_id_function=lambda route: route.name
+)
+
+# Error codes for errors raised without a specific code, by HTTP status
+DEFAULT_PROBLEM_CODES = {
+    400: "bad_request",
+    401: "unauthorized",
+    403: "forbidden",
+    404: "not_found",
+    405: "method_not_allowed",
+    409: "conflict",
+    422: "validation_failed",
+    429: "rate_limited",
+    500: "internal_error",
+    503: "service_unavailable"
+}
+
+# HTTP error with a stable, machine-readable error code, so clients don't have to match on the detail message
+class ApiError(HTTPException):
+    def __init__(self, status_code, code, detail=None, headers=None):
+        super().__init__(status_code=status_code, detail=detail, headers=headers)
+        self.code = code
+
+# Invalid input found while processing a request, with its error code. The processing functions turn these into
+# ApiErrors: 400 by default, or 422 when well-formed input can't be modeled (e.g. too little history to fit).
+# Any other exception is unexpected and becomes an internal_error.
+class InputError(ValueError):
+    def __init__(self, code, message, status_code=400):
+        super().__init__(message)
+        self.code = code
+        self.status_code = status_code
+
+# Helper to get the error code of an HTTP error
+def problem_code(exc):
+    return getattr(exc, "code", None) or DEFAULT_PROBLEM_CODES.get(exc.status_code, "error")
+
+# Helper to build an RFC 7807 problem details object. The type is a URN naming the error code.
+def problem_details(status_code, code, detail, instance=None, **extensions):
+    problem = {
+        "type": f"urn:optivest:problem:{code}",
+        "title": HTTPStatus(status_code).phrase,
+        "status": status_code,
+        "detail": detail,
+        "code": code,
+        "request_id": current_request_id.get()
+    }
+    if instance:
+        problem["instance"] = instance
+    return {**problem, **extensions}
+
+# Helper to send a problem details object as an application/problem+json response
+def problem_response(request, status_code, code, detail, headers=None, **extensions):
+    return JSONResponse(
+        status_code=status_code,
+        content=jsonable_encoder(problem_details(status_code, code, detail, request.url.path, **extensions)),
+        media_type="application/problem+json",
+        headers=headers
+    )
+
+# Reply to HTTP errors, including unknown routes and unsupported methods, with problem details
+@app.exception_handler(StarletteHTTPException)
+async def http_error_handler(request: Request, exc: StarletteHTTPException):
+    return problem_response(request, exc.status_code, problem_code(exc), exc.detail, headers=getattr(exc, "headers", None))
+
+# Reply to request validation errors with problem details, listing each invalid field
+@app.exception_handler(RequestValidationError)
+async def validation_error_handler(request: Request, exc: RequestValidationError):
+    return problem_response(request, 422, "validation_failed", "Request validation failed", errors=exc.errors())
+
+# Reply to unhandled errors with problem details, without exposing their internals. These replies are sent outside
+# the request ID middleware, so the request ID header is added here.
+@app.exception_handler(Exception)
+async def unhandled_error_handler(request: Request, exc: Exception):
+    logger.error(f"Unhandled error on {request.url.path}: {str(exc)}")
+    return problem_response(request, 500, "internal_error", "Internal server error", headers={"X-Request-ID": current_request_id.get()})
+
+# Helper to read a comma-separated list from an environment variable
+def env_list(name, default):
+    value = os.environ.get(name)
+    if value is None:
+        return default
+    return [item.strip() for item in value.split(",") if item.strip()]
+
+# CORS for the OptiVest web app, enabled by listing its origins in CORS_ALLOWED_ORIGINS (e.g. https://app.optivest.com)
+CORS_ALLOWED_ORIGINS = env_list("CORS_ALLOWED_ORIGINS", [])
+CORS_ALLOWED_METHODS = env_list("CORS_ALLOWED_METHODS", ["GET", "POST", "PUT", "DELETE"])
+CORS_ALLOWED_HEADERS = env_list("CORS_ALLOWED_HEADERS", ["Authorization", "Content-Type", "X-API-Key", "X-Request-ID"])
+CORS_ALLOW_CREDENTIALS = os.environ.get("CORS_ALLOW_CREDENTIALS", "false").lower() == "true"
+CORS_MAX_AGE = 600
+
+# Redirect plain HTTP and WS requests to HTTPS and WSS. Behind a TLS-terminating proxy, requests are redirected unless
+# the proxy's X-Forwarded-Proto says they arrived over HTTPS. When serving TLS directly, the HTTPS port never sees
+# plain HTTP, so a separate listener on HTTP_REDIRECT_PORT redirects instead.
+HTTPS_REDIRECT = os.environ.get("HTTPS_REDIRECT", "false").lower() == "true"
+HTTP_REDIRECT_PORT = int(os.environ.get("HTTP_REDIRECT_PORT", "80"))
+
+# Response headers the web app may read across origins
+CORS_EXPOSED_HEADERS = ["Retry-After", "Deprecation", "Sunset", "Link", "X-Request-ID"]
+
+# JWT authentication shared with the main OptiVest API, enabled by setting JWT_SECRET (HS256)
+JWT_SECRET = os.environ.get("JWT_SECRET")
+JWT_ISSUER = os.environ.get("JWT_ISSUER")
+JWT_AUDIENCE = os.environ.get("JWT_AUDIENCE")
+JWT_LEEWAY_SECONDS = 30
+
+# RFC 7662 introspection of opaque access tokens against the OptiVest auth server, enabled by setting
+# OAUTH_INTROSPECTION_URL. Results are cached briefly so each token isn't introspected on every request.
+OAUTH_INTROSPECTION_URL = os.environ.get("OAUTH_INTROSPECTION_URL")
+OAUTH_CLIENT_ID = os.environ.get("OAUTH_CLIENT_ID")
+OAUTH_CLIENT_SECRET = os.environ.get("OAUTH_CLIENT_SECRET")
+INTROSPECTION_CACHE_SECONDS = 60
+INTROSPECTION_TIMEOUT = 5
+MAX_CACHED_INTROSPECTIONS = 10000
+introspection_cache = OrderedDict()
+
+# Admin routes of every API version, which only API keys with the admin scope may call
+ADMIN_PATH_PATTERN = re.compile(r"^/v\d+/admin/")
+
+# User authentication is on when tokens can be verified either way
+USER_AUTH_ENABLED = bool(JWT_SECRET or OAUTH_INTROSPECTION_URL)
+
+# One-time tickets that authenticate WebSocket upgrades, since browsers can't send an Authorization header with them
+WS_TICKET_SECONDS = 30
+ws_tickets = {}
+
+# The authenticated user's ID, or the service API key's name, for the current request or background job
+current_user_id = contextvars.ContextVar("current_user_id", default=None)
+current_api_key = contextvars.ContextVar("current_api_key", default=None)
+
+# Requests per minute allowed for each authenticated user and, for unauthenticated calls, each client IP
+USER_RATE_LIMIT_PER_MINUTE = int(os.environ.get("USER_RATE_LIMIT_PER_MINUTE", "120"))
+IP_RATE_LIMIT_PER_MINUTE = int(os.environ.get("IP_RATE_LIMIT_PER_MINUTE", "300"))
+MAX_TRACKED_CLIENTS = 10000
+client_usage = {}
+
+# Helper to enforce a sliding one-minute rate limit for a client, returning the seconds until the client
+# may retry, or None if the request is allowed
+def check_rate_limit(usage_by_client, client, limit):
+    now = time.monotonic()
+
+    # Forget clients that have been idle for a minute once many are tracked
+    if len(usage_by_client) > MAX_TRACKED_CLIENTS:
+        for idle in [key for key, usage in usage_by_client.items() if not usage or now - usage[-1] >= 60]:
+            del usage_by_client[idle]
+
+    usage = usage_by_client.setdefault(client, deque())
+    while usage and now - usage[0] >= 60:
+        usage.popleft()
+    if len(usage) >= limit:
+        return math.ceil(60 - (now - usage[0]))
+    usage.append(now)
+    return None
+
+# API keys for service-to-service calls from the main backend, kept apart from user authentication.
+# Keys are stored by the SHA-256 of the secret and seeded from the API_KEYS environment variable, a JSON object of
+# {"<name>": {"key": "<secret>", "scopes": ["predict", "admin"], "rate_limit_per_minute": 600}}.
+API_KEY_SCOPES = ("predict", "admin")
+DEFAULT_API_KEY_RATE_LIMIT = 600
+api_keys = {}
+api_key_usage = {}
+
+# Helper to hash an API key secret for storage and lookup
+def hash_api_key(secret):
+    return hashlib.sha256(secret.encode()).hexdigest()
+
+# Helper to register an API key, replacing any existing key with the same name
+def add_api_key(name, secret, scopes, rate_limit_per_minute):
+    if not scopes or set(scopes) - set(API_KEY_SCOPES):
+        raise ValueError(f"API key scopes must be from: {', '.join(API_KEY_SCOPES)}")
+    if rate_limit_per_minute < 1:
+        raise ValueError("API key rate limit must be at least 1 request per minute")
+
+    for key_hash in [key_hash for key_hash, key in api_keys.items() if key["name"] == name]:
+        del api_keys[key_hash]
+    api_keys[hash_api_key(secret)] = {
+        "name": name,
+        "scopes": list(scopes),
+        "rate_limit_per_minute": rate_limit_per_minute,
+        "created_at": datetime.now(timezone.utc).isoformat()
+    }
+
+for name, settings in json.loads(os.environ.get("API_KEYS", "{}")).items():
+    add_api_key(
+        name, settings["key"], settings.get("scopes", ["predict"]),
+        settings.get("rate_limit_per_minute", DEFAULT_API_KEY_RATE_LIMIT)
+    )
+
+# Authenticate a service call by its API key, checking the key's scope for the route and its rate limit
+def authenticate_api_key(connection, secret):
+    key = api_keys.get(hash_api_key(secret))
+    if key is None:
+        raise ApiError(401, "invalid_api_key", detail="Invalid API key")
+
+    scope = "admin" if ADMIN_PATH_PATTERN.match(connection.url.path) else "predict"
+    if scope not in key["scopes"]:
+        raise ApiError(403, "insufficient_scope", detail=f"API key lacks the {scope} scope")
+
+    retry_after = check_rate_limit(api_key_usage, key["name"], key["rate_limit_per_minute"])
+    if retry_after is not None:
+        raise ApiError(429, "rate_limited", detail="API key rate limit exceeded", headers={"Retry-After": str(retry_after)})
+
+    connection.state.api_key = key["name"]
+    current_api_key.set(key["name"])
+
+# Helper to decode base64url without padding, as used by JWTs
+def base64url_decode(value):
+    return base64.urlsafe_b64decode(value + "=" * (-len(value) % 4))
+
+# Helper to check that a token time claim is a NumericDate, i.e. a number of seconds since the epoch
+def is_numeric_date(value):
+    return isinstance(value, (int, float)) and not isinstance(value, bool)
+
+# Verify an HS256 JWT's signature and registered claims, returning its claims
+def decode_jwt(token):
+    try:
+        header_segment, payload_segment, signature_segment = token.split(".")
+        header = json.loads(base64url_decode(header_segment))
+        claims = json.loads(base64url_decode(payload_segment))
+        signature = base64url_decode(signature_segment)
+    except Exception:
+        raise ValueError("Malformed token")
+    if not isinstance(header, dict) or not isinstance(claims, dict):
+        raise ValueError("Malformed token")
+
+    if header.get("alg") != "HS256":
+        raise ValueError("Unsupported token algorithm")
+    expected = hmac.new(JWT_SECRET.encode(), f"{header_segment}.{payload_segment}".encode(), hashlib.sha256).digest()
+    if not hmac.compare_digest(signature, expected):
+        raise ValueError("Invalid token signature")
+
+    # Tokens must expire, and time claims must be numeric dates (seconds since the epoch)
+    if not is_numeric_date(claims.get("exp")):
+        raise ValueError("Token has no valid expiry")
+    if "nbf" in claims and not is_numeric_date(claims["nbf"]):
+        raise ValueError("Token has an invalid not-before time")
+
+    now = time.time()
+    if now > claims["exp"] + JWT_LEEWAY_SECONDS:
+        raise ValueError("Token has expired")
+    if "nbf" in claims and now < claims["nbf"] - JWT_LEEWAY_SECONDS:
+        raise ValueError("Token is not valid yet")
+    if JWT_ISSUER and claims.get("iss") != JWT_ISSUER:
+        raise ValueError("Invalid token issuer")
+    audiences = claims.get("aud") if isinstance(claims.get("aud"), list) else [claims.get("aud")]
+    if JWT_AUDIENCE and JWT_AUDIENCE not in audiences:
+        raise ValueError("Invalid token audience")
+    if not claims.get("sub"):
+        raise ValueError("Token has no subject")
+    return claims
+
+# Ask the auth server whether an opaque token is active, returning its introspection response
+def introspect_token(token):
+    request = urllib.request.Request(
+        OAUTH_INTROSPECTION_URL,
+        data=urllib.parse.urlencode({"token": token, "token_type_hint": "access_token"}).encode(),
+        method="POST",
+        headers={
+            "Content-Type": "application/x-www-form-urlencoded",
+            "Accept": "application/json",
+            "X-Request-ID": current_request_id.get()
+        }
+    )
+    if OAUTH_CLIENT_ID:
+        credentials = base64.b64encode(f"{OAUTH_CLIENT_ID}:{OAUTH_CLIENT_SECRET or ''}".encode()).decode()
+        request.add_header("Authorization", f"Basic {credentials}")
+
+    with urllib.request.urlopen(request, timeout=INTROSPECTION_TIMEOUT) as response:
+        return json.loads(response.read())
+
+# Validate an opaque token by introspection, returning its claims. Results are cached for a short time,
+# and never past the token's expiry.
+async def verify_opaque_token(token):
+    key = hash_api_key(token)
+    now = time.time()
+    cached = introspection_cache.get(key)
+    if cached is not None and cached[0] > now:
+        claims = cached[1]
+    else:
+        try:
+            claims = await asyncio.to_thread(introspect_token, token)
+        except Exception as e:
+            logger.error(f"Token introspection failed: {str(e)}")
+            raise ApiError(503, "auth_unavailable", detail="Token introspection is unavailable")
+
+        exp = claims.get("exp")
+        expires_at = min(now + INTROSPECTION_CACHE_SECONDS, exp if is_numeric_date(exp) else float("inf"))
+        introspection_cache[key] = (expires_at, claims)
+        if len(introspection_cache) > MAX_CACHED_INTROSPECTIONS:
+            introspection_cache.popitem(last=False)
+
+    if not claims.get("active"):
+        raise ValueError("Token is not active")
+    if not claims.get("sub"):
+        raise ValueError("Token has no subject")
+    return claims
+
+# Verify a bearer token: JWTs with the shared secret, anything else by introspection
+async def verify_token(token):
+    if JWT_SECRET and (token.count(".") == 2 or not OAUTH_INTROSPECTION_URL):
+        return decode_jwt(token)
+    return await verify_opaque_token(token)
+
+# Helper to issue a one-time WebSocket ticket for a user, dropping expired tickets
+def issue_ws_ticket(user_id):
+    now = time.time()
+    for expired in [ticket for ticket, (expires_at, _) in ws_tickets.items() if expires_at <= now]:
+        del ws_tickets[expired]
+
+    ticket = secrets.token_urlsafe(32)
+    ws_tickets[ticket] = (now + WS_TICKET_SECONDS, user_id)
+    return ticket
+
+# Helper to redeem a WebSocket ticket, returning its user. A ticket works once, and only until it expires.
+def redeem_ws_ticket(ticket):
+    expires_at, user_id = ws_tickets.pop(ticket, (0, None))
+    if expires_at <= time.time():
+        raise ValueError("Invalid or expired ticket")
+    return user_id
+
+# Dependency that authenticates every v1 REST call and WebSocket upgrade when user authentication is enabled.
+# REST calls send a bearer token. WebSocket upgrades send a one-time ticket from POST /v1/ws-ticket instead,
+# so tokens never appear in URLs.
+async def authenticate(connection: HTTPConnection):
+    # Service calls from the main backend authenticate with an API key instead of a user token
+    api_key = connection.headers.get("x-api-key")
+    if api_key is not None:
+        authenticate_api_key(connection, api_key)
+        return
+
+    # Admin routes are for services with an admin-scoped API key only, whether or not user authentication is on
+    if ADMIN_PATH_PATTERN.match(connection.url.path):
+        raise ApiError(401, "api_key_required", detail="Admin endpoints require an API key")
+
+    if not USER_AUTH_ENABLED:
+        return
+
+    if connection.scope["type"] == "websocket":
+        try:
+            user_id = redeem_ws_ticket(connection.query_params.get("ticket", ""))
+        except ValueError as e:
+            raise WebSocketException(code=status.WS_1008_POLICY_VIOLATION, reason=str(e))
+    else:
+        scheme, _, token = connection.headers.get("authorization", "").partition(" ")
+        try:
+            if scheme.lower() != "bearer" or not token:
+                raise ValueError("Missing bearer token")
+            user_id = (await verify_token(token))["sub"]
+        except ValueError as e:
+            raise ApiError(401, "invalid_token", detail=str(e), headers={"WWW-Authenticate": "Bearer"})
+
+    connection.state.user_id = user_id
+    current_user_id.set(user_id)
+
+# Helper to resolve the user a request acts for. With authentication enabled, this is the authenticated user,
+# and a different user ID is rejected. Services calling with an API key may act for any user.
+def authorize_user(user_id):
+    if not USER_AUTH_ENABLED or current_api_key.get():
+        return user_id
+    authenticated_user_id = current_user_id.get()
+    if user_id is not None and user_id != authenticated_user_id:
+        raise ApiError(403, "user_mismatch", detail="Not allowed to act for this user")
+    return authenticated_user_id
+
+# Helper to check whether the caller is a service whose API key has the given scope
+def has_api_key_scope(scope):
+    name = current_api_key.get()
+    return name is not None and any(key["name"] == name and scope in key["scopes"] for key in api_keys.values())
+
+# Helper to check whether the caller may see a stored prediction or job. Users only see their own, while services
+# with an API key act for every user.
+def can_access(owner_id):
+    return not USER_AUTH_ENABLED or current_api_key.get() is not None or owner_id == current_user_id.get()
+
+# Helper to authorize the user ID of a request body, for request models that have one
+def authorize_payload(request_model, payload):
+    if "user_id" not in request_model.__fields__:
+        return payload
+    return {**payload, "user_id": authorize_user(payload.get("user_id"))}
+
+# Dependency that rate limits every v1 REST call and WebSocket upgrade per authenticated user, or per client IP
+# for unauthenticated calls. Service calls are limited per API key during authentication instead.
+async def rate_limit(connection: HTTPConnection):
+    if current_api_key.get():
+        return
+
+    user_id = current_user_id.get()
+    if user_id is not None:
+        retry_after = check_rate_limit(client_usage, f"user:{user_id}", USER_RATE_LIMIT_PER_MINUTE)
+    else:
+        # Behind a load balancer this is the proxy's IP, unless uvicorn trusts its X-Forwarded-For through FORWARDED_ALLOW_IPS
+        host = connection.client.host if connection.client else "unknown"
+        retry_after = check_rate_limit(client_usage, f"ip:{host}", IP_RATE_LIMIT_PER_MINUTE)
+
+    if retry_after is not None:
+        if connection.scope["type"] == "websocket":
+            raise WebSocketException(code=status.WS_1008_POLICY_VIOLATION, reason="Rate limit exceeded")
+        raise ApiError(429, "rate_limited", detail="Rate limit exceeded", headers={"Retry-After": str(retry_after)})
+
+# Create a router for one API version, authenticating and rate limiting every route on it. A new version (e.g. v2)
+# gets its own router, registered in api_routers, and is served side by side with the older versions.
+def create_api_router(version):
+    return APIRouter(prefix=f"/{version}", dependencies=[Depends(authenticate), Depends(rate_limit)])
 
 # Create a new router for version 1 (v1)
-v1_router = APIRouter(prefix="/v1")
+v1_router = create_api_router("v1")
+
+# Every API version served, in the order they are included in the app
+api_routers = [v1_router]
+
+# Incoming request IDs are kept if they are short and safe to log, otherwise a new one is generated
+REQUEST_ID_PATTERN = re.compile(r"^[A-Za-z0-9._:-]{1,128}$")
+
+# Middleware giving every HTTP request and WebSocket connection a request ID, taken from the caller's X-Request-ID
+# header or generated, so one user action can be traced through logs, jobs and webhooks. HTTP responses echo it.
+class RequestIDMiddleware:
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] not in ("http", "websocket"):
+            await self.app(scope, receive, send)
+            return
+
+        incoming = dict(scope["headers"]).get(b"x-request-id", b"").decode("latin-1")
+        request_id = incoming if REQUEST_ID_PATTERN.match(incoming) else uuid.uuid4().hex
+        current_request_id.set(request_id)
+
+        async def send_with_request_id(message):
+            if message["type"] == "http.response.start":
+                message["headers"] = [*message.get("headers", []), (b"x-request-id", request_id.encode())]
+            await send(message)
+
+        await self.app(scope, receive, send_with_request_id)
+
+# Deprecated API paths by path prefix, i.e. a single route or a whole version such as "/v1". Each entry has the date it
+# was deprecated, its sunset date after which it may be removed, and optionally the path replacing it, e.g.
+# "/v1/predict": {"deprecated": "2026-11-01", "sunset": "2027-05-01", "successor": "/v2/predictions"}
+DEPRECATED_API_PATHS = {}
+
+# Helper to find the deprecation of a request path, matching whole path segments
+def find_deprecation(path):
+    for prefix, deprecation in DEPRECATED_API_PATHS.items():
+        if path == prefix or path.startswith(prefix.rstrip("/") + "/"):
+            return deprecation
+    return None
+
+# Helper to parse a deprecation date (YYYY-MM-DD) as midnight UTC
+def parse_deprecation_date(value):
+    return datetime.fromisoformat(value).replace(tzinfo=timezone.utc)
+
+# Middleware announcing deprecated routes to clients: the Deprecation header (RFC 9745) with the deprecation date,
+# the Sunset header (RFC 8594), and a Link to the successor. Deprecated routes keep answering as before.
+@app.middleware("http")
+async def add_deprecation_headers(request: Request, call_next):
+    response = await call_next(request)
+    deprecation = find_deprecation(request.url.path)
+    if deprecation is None:
+        return response
+
+    response.headers["Deprecation"] = f"@{int(parse_deprecation_date(deprecation['deprecated']).timestamp())}"
+    if deprecation.get("sunset"):
+        response.headers["Sunset"] = format_datetime(parse_deprecation_date(deprecation["sunset"]), usegmt=True)
+    if deprecation.get("successor"):
+        response.headers["Link"] = f'<{deprecation["successor"]}>; rel="successor-version"'
+    return response
 
 # Define the data model for the incoming request using Pydantic
 class PredictionRequest(BaseModel):
@@ -32,6 +550,431 @@ class PredictionRequest(BaseModel):
     tax_rate: float = 0.1  # Default tax rate of 10%
     enable_seasonality: bool = False  # Option to enable seasonality
     enable_holidays: bool = False  # Option to enable holidays
+    model: str = "prophet"  # Forecasting model to use for expenses and incomes
+    model_version: str = None  # Pin a registered model version, defaults to the active one
+    include_components: bool = False  # Option to return the Prophet trend/seasonality/holiday breakdown
+    include_explanations: bool = False  # Option to explain each Prophet forecast by its top contributing features
+    confidence_level: float = 0.8  # Coverage of the yhat_lower/yhat_upper interval, e.g. 0.8 or 0.95
+    exclude_anomalies: bool = False  # Option to interpolate over anomalous values before forecasting
+
+# Define the data model for an on-demand forecast of a single series
+class SeriesPredictionRequest(BaseModel):
+    symbol: str  # Label for the series, e.g. a ticker or an account name
+    values: list
+    start_date: str
+    frequency: str = "monthly"  # Default to monthly if not provided
+    horizon: int = None  # Defaults to 3 periods, or to the default horizons for crypto
+    horizons: list[int] = None  # Optional set of horizons (in periods) to report, e.g. [1, 7, 30, 365] for daily data
+    model: str = "prophet"  # Default to Prophet if not provided
+    model_version: str = None  # Pin a registered model version, defaults to the active one
+    country: str = "Kenya"  # Default to Kenya if not provided
+    enable_seasonality: bool = False  # Option to enable seasonality
+    enable_holidays: bool = False  # Option to enable holidays
+    confidence_level: float = 0.8  # Coverage of the yhat_lower/yhat_upper interval, e.g. 0.8 or 0.95
+    exclude_anomalies: bool = False  # Option to interpolate over anomalous values before forecasting
+    include_explanations: bool = False  # Option to explain each Prophet forecast by its top contributing features
+    sentiment: list[float] = None  # Sentiment score per period (e.g. -1 to 1), used by model versions with use_sentiment
+    asset_class: str = "equity"  # "equity" or "crypto"; crypto trades 24/7, so it has no holiday effects
+
+# Define the data model for forecasting several series (e.g. a whole portfolio) in one request
+class BatchPredictionRequest(BaseModel):
+    predictions: list[SeriesPredictionRequest]
+
+# Define the data model for registering a new version of a forecasting model
+class ModelVersionRequest(BaseModel):
+    name: str  # One of the supported forecasting models
+    version: str
+    asset_classes: list[str] = []  # Asset classes the version is intended for, empty for any
+    hyperparameters: dict = {}
+    artifact_location: str = None  # Where the fitted artifact lives, if the model has one
+    use_sentiment: bool = False  # Include sentiment scores as a regressor (Prophet only)
+    fallback_model: str = None  # Model to serve this version's requests with while it is flagged as drifted
+
+# Define the data model for issuing an API key to a service
+class ApiKeyRequest(BaseModel):
+    name: str  # Identifies the calling service, e.g. "optivest-backend"
+    scopes: list[str] = ["predict"]  # "predict" for the forecasting endpoints, "admin" for /v1/admin
+    rate_limit_per_minute: int = 600
+
+# Define the data model for a walk-forward backtest of a forecasting model over a series
+class BacktestRequest(BaseModel):
+    values: list
+    start_date: str
+    frequency: str = "monthly"  # Default to monthly if not provided
+    model: str = "prophet"  # Default to Prophet if not provided
+    model_version: str = None  # Pin a registered model version, defaults to the active one
+    initial_window: int = 12  # Number of periods in the first training window
+    horizon: int = 1  # How many periods ahead each forecast is scored
+    country: str = "Kenya"  # Default to Kenya if not provided
+    enable_seasonality: bool = False  # Option to enable seasonality
+    enable_holidays: bool = False  # Option to enable holidays
+
+# Define the data model for tuning ensemble weights from the backtest accuracy of each member model
+class EnsembleTuningRequest(BaseModel):
+    version: str  # Ensemble version to register with the tuned weights
+    members: list[str] = ["arima", "holt_winters", "seasonal_naive"]  # Models to combine
+    values: list
+    start_date: str
+    frequency: str = "monthly"  # Default to monthly if not provided
+    initial_window: int = 12  # Number of periods in the first training window
+    horizon: int = 1  # How many periods ahead each forecast is scored
+    country: str = "Kenya"  # Default to Kenya if not provided
+    enable_seasonality: bool = False  # Option to enable seasonality
+    enable_holidays: bool = False  # Option to enable holidays
+    activate: bool = False  # Option to make the tuned version the active ensemble version
+
+# Define the data model for submitting a long-running computation as a background job
+class JobRequest(BaseModel):
+    type: str  # One of the supported job types, e.g. "backtest" or "portfolio_optimization"
+    payload: dict  # Request body for the job type's own endpoint
+    callback_url: str = None  # Optional URL to POST the finished job to (API keys only), defaults to the configured WEBHOOK_URL
+
+# Define the data model for a realized value of a forecast series
+class RealizedValue(BaseModel):
+    ds: str  # Date in YYYY-MM-DD format, matching the forecast 'ds'
+    y: float
+
+# Define the data model for reporting realized values against an issued prediction
+class ActualsRequest(BaseModel):
+    actuals: list[RealizedValue]
+
+# Define the data model for computing technical indicators over a price series
+class IndicatorRequest(BaseModel):
+    close: list
+    high: list = None  # Needed for ATR and the stochastic oscillator
+    low: list = None  # Needed for ATR and the stochastic oscillator
+    start_date: str = None  # Optional, labels each value with its date
+    frequency: str = "daily"  # Default to daily if not provided
+    indicators: list[str] = None  # Defaults to every indicator the provided data supports
+    window: int = 20  # Window for SMA, EMA and Bollinger Bands
+    period: int = 14  # Period for RSI, ATR and the stochastic oscillator
+    num_std: float = 2.0  # Width of the Bollinger Bands in standard deviations
+
+# Define the data model for a historical series included in a training dataset export
+class DatasetSeries(BaseModel):
+    symbol: str
+    values: list
+    start_date: str
+
+# Define the data model for exporting aligned feature/target datasets for offline model training
+class DatasetExportRequest(BaseModel):
+    series: list[DatasetSeries]
+    frequency: str = "monthly"  # Default to monthly if not provided
+    from_date: str = None  # Optional first date (YYYY-MM-DD) of the exported rows
+    to_date: str = None  # Optional last date (YYYY-MM-DD) of the exported rows
+    lags: list[int] = [1, 2, 3]  # Lagged values to include as features
+    window: int = 3  # Window for the rolling mean and standard deviation features
+    target_horizon: int = 1  # Periods ahead of each row that the target value is taken from
+    format: str = "csv"  # "csv" or "json"
+
+# Define the data model for detecting anomalous values in a series
+class AnomalyRequest(BaseModel):
+    values: list
+    start_date: str = None  # Optional, labels each anomaly with its date
+    frequency: str = "monthly"  # Default to monthly if not provided
+    threshold: float = 3.0  # Z-score beyond which a value is flagged
+
+# Define the data model for a position held in a portfolio
+class PortfolioPosition(BaseModel):
+    symbol: str
+    value: float  # Current market value of the position
+    prices: list  # Historical prices at a fixed frequency, oldest first
+
+# Define the data model for a Monte Carlo projection of a portfolio's value
+class PortfolioProjectionRequest(BaseModel):
+    positions: list[PortfolioPosition]
+    horizons: list[int] = [12]  # Periods ahead to report, in the frequency of the price histories
+    simulations: int = 5000  # Number of simulated paths
+    percentiles: list[float] = [5, 25, 50, 75, 95]
+    seed: int = None  # Optional seed for reproducible simulations
+    user_id: str = None  # Optional user whose calibration profile adjusts the projection
+    periods_per_year: int = 12  # 12 for monthly prices, 52 for weekly, 252 for daily; used to apply calibration
+
+# Define the data model for a Value-at-Risk calculation on a portfolio
+class RiskRequest(BaseModel):
+    positions: list[PortfolioPosition]
+    confidence_levels: list[float] = [0.95, 0.99]
+    horizon: int = 1  # Periods ahead, in the frequency of the price histories
+    volatility_model: str = "historical"  # "historical", or "garch" to add VaR from a GARCH(1,1) volatility forecast
+
+# Define the data model for risk-adjusted performance metrics of a portfolio and its positions
+class PerformanceMetricsRequest(BaseModel):
+    positions: list[PortfolioPosition]
+    benchmark_prices: list = None  # Optional benchmark price history (same frequency) for beta
+    risk_free_rate: float = 0.0  # Annual risk-free rate, e.g. 0.04 for 4%
+    periods_per_year: int = 12  # 12 for monthly prices, 52 for weekly, 252 for daily
+
+# Define the data model for an asset considered by the portfolio optimizer
+class OptimizationAsset(BaseModel):
+    symbol: str
+    prices: list  # Historical prices at a fixed frequency, oldest first
+
+# Define the data model for forward volatility forecasts of one or more symbols
+class VolatilityRequest(BaseModel):
+    assets: list[OptimizationAsset]
+    horizon: int = 10  # Periods ahead, in the frequency of the price histories
+    periods_per_year: int = None  # 12 for monthly prices, 52 for weekly; defaults to daily (252, or 365 for crypto)
+    asset_class: str = "equity"  # "equity" or "crypto"
+    confidence_level: float = 0.95  # Coverage of the forecast price range
+    elevated_threshold: float = 1.25  # Forecast-to-long-run volatility ratio at which volatility is flagged as elevated
+
+# Define the data model for a mean-variance portfolio optimization
+class PortfolioOptimizationRequest(BaseModel):
+    assets: list[OptimizationAsset]
+    objective: str = "max_sharpe"  # "min_variance", "max_sharpe" or "target_return"
+    target_return: float = None  # Annual return to reach for the "target_return" objective
+    risk_free_rate: float = 0.0  # Annual risk-free rate, e.g. 0.04 for 4%
+    periods_per_year: int = 12  # 12 for monthly prices, 52 for weekly, 252 for daily
+    min_weight: float = 0.0  # Lower bound per asset, 0 disallows short selling
+    max_weight: float = 1.0  # Upper bound per asset
+    frontier_points: int = 0  # Number of efficient frontier points to return alongside the allocation
+
+# Define the data model for a holding in a portfolio being rebalanced
+class Holding(BaseModel):
+    symbol: str
+    value: float  # Current market value of the holding
+
+# Define the data model for a rebalancing recommendation against target weights
+class RebalanceRequest(BaseModel):
+    holdings: list[Holding]
+    target_weights: dict[str, float]  # Target weight per symbol, e.g. the optimizer's allocation weights
+    cash: float = 0.0  # Uninvested cash available to the rebalance
+    drift_threshold: float = 0.05  # Weight drift (e.g. 0.05 for 5 points) beyond which a rebalance is recommended
+    transaction_cost_rate: float = 0.001  # Estimated cost as a share of each trade's amount
+    fixed_cost_per_trade: float = 0.0  # Estimated fixed cost of each trade
+
+# Define the data model for a correlation matrix and diversification score over a set of assets
+class CorrelationRequest(BaseModel):
+    assets: list[OptimizationAsset]
+    lookbacks: list[int] = None  # Numbers of most recent returns to use, defaults to the full aligned history
+    weights: dict[str, float] = None  # Portfolio weights for the diversification ratio, equal weights if not set
+
+# Define the data model for projecting whether a savings or investment goal will be met
+class GoalProjectionRequest(BaseModel):
+    current_balance: float
+    monthly_contribution: float
+    goal: float
+    months: int  # Months until the goal's deadline
+    expected_annual_return: float = 0.05  # Default to 5% a year if not provided
+    annual_volatility: float = 0.10  # Default to 10% a year if not provided
+    simulations: int = 5000  # Number of simulated paths
+    milestones: list[float] = [0.25, 0.5, 0.75, 1.0]  # Shares of the goal to report progress for
+    seed: int = None  # Optional seed for reproducible simulations
+    user_id: str = None  # Optional user whose calibration profile adjusts the projection
+
+# Define the data model for a debt being paid off
+class Debt(BaseModel):
+    name: str
+    balance: float
+    apr: float  # Annual percentage rate, e.g. 0.199 for 19.9%
+    minimum_payment: float
+
+# Define the data model for forecasting debt payoff under different strategies
+class DebtPayoffRequest(BaseModel):
+    debts: list[Debt]
+    monthly_budget: float  # Total amount available for debt payments each month
+    strategies: list[str] = ["avalanche", "snowball"]
+    start_date: str = None  # Month of the first payment, defaults to the current month
+    include_schedule: bool = False  # Option to return the month-by-month payment schedule
+
+# Define the data model for a retirement readiness projection
+class RetirementProjectionRequest(BaseModel):
+    current_age: int
+    retirement_age: int
+    life_expectancy: int = 90  # Age the savings need to last until
+    current_balance: float
+    annual_contribution: float  # Contribution this year, until retirement
+    contribution_growth: float = 0.02  # Yearly increase in contributions
+    annual_retirement_spending: float  # Yearly spending in retirement, in today's money
+    inflation: float = 0.025  # Yearly inflation, applied to retirement spending
+    stock_return: float = 0.07  # Expected yearly stock return
+    stock_volatility: float = 0.16
+    bond_return: float = 0.03  # Expected yearly bond return
+    bond_volatility: float = 0.05
+    stock_bond_correlation: float = 0.1
+    glide_path_start: float = 0.9  # Stock allocation today
+    glide_path_end: float = 0.4  # Stock allocation from retirement onwards
+    simulations: int = 5000  # Number of simulated paths
+    seed: int = None  # Optional seed for reproducible simulations
+    user_id: str = None  # Optional user whose calibration profile adjusts the projection
+
+# Define the data model for a single hypothetical change to a projection request
+class ScenarioChange(BaseModel):
+    field: str  # Request field to change, or "list_field.item_field" to change every item, e.g. "debts.apr"
+    operation: str = "add"  # "set", "add", "multiply", or "remove" to drop list items by symbol/name
+    value: Any
+
+# Define the data model for comparing a baseline projection with what-if scenarios
+class ScenarioRequest(BaseModel):
+    projection: str  # "goal", "retirement", "debt_payoff" or "portfolio"
+    baseline: dict  # Request body for the projection's own endpoint
+    scenarios: dict[str, list[ScenarioChange]]  # Named scenarios, each a list of changes to the baseline
+
+# Define the data model for a categorized transaction from the main backend
+class Transaction(BaseModel):
+    date: str
+    amount: float  # Amount spent, as a positive number
+    category: str
+
+# Define the data model for forecasting next month's spend per category
+class BudgetForecastRequest(BaseModel):
+    transactions: list[Transaction]
+    budgets: dict[str, float] = {}  # Monthly budget per category
+    method: str = "ets"  # "ets" (Holt-Winters, falling back to seasonal naive) or "seasonal_naive"
+    confidence_level: float = 0.8  # Coverage of the forecast interval
+
+# Define the data model for classifying raw transaction descriptions into categories
+class CategorizationRequest(BaseModel):
+    user_id: str = None  # Defaults to the authenticated user when authentication is enabled
+    descriptions: list[str]
+
+# Define the data model for a user's correction of a transaction's category
+class CategoryFeedbackRequest(BaseModel):
+    user_id: str = None  # Defaults to the authenticated user when authentication is enabled
+    description: str
+    category: str
+
+# Define the data model for a user's calibration profile for projections
+class CalibrationProfileRequest(BaseModel):
+    profile: str = "base"  # "conservative", "base" or "aggressive"
+    return_adjustment: float = None  # Added to annual return assumptions, overrides the profile's, e.g. -0.01
+    volatility_multiplier: float = None  # Scales volatility assumptions, overrides the profile's, e.g. 1.2
+
+# Define the data model for a transaction used in cash-flow forecasting
+class CashFlowTransaction(BaseModel):
+    date: str
+    amount: float  # Positive for income, negative for spending
+    description: str
+
+# Define the data model for forecasting near-term cash flow from transaction history
+class CashFlowRequest(BaseModel):
+    transactions: list[CashFlowTransaction]
+    current_balance: float
+    start_date: str = None  # First day of the forecast, defaults to today
+    days: int = 30  # Number of days to forecast
+    low_balance_threshold: float = 0.0  # Balance below which a warning is raised
+
+
+# Debt payoff strategies: avalanche targets the highest APR first, snowball the smallest balance first
+DEBT_STRATEGIES = ("avalanche", "snowball")
+
+# Longest payoff schedule simulated before a plan is considered never to finish
+MAX_PAYOFF_MONTHS = 600
+
+# Objectives supported by the portfolio optimizer
+OPTIMIZATION_OBJECTIVES = ("min_variance", "max_sharpe", "target_return")
+
+# Upper bounds on simulated paths and periods per request, and on the values simulated in total
+# (paths x periods x assets, about 160 MB as floats), to keep memory and CPU in check
+MAX_SIMULATIONS = 100000
+MAX_SIMULATION_PERIODS = 1200
+MAX_SIMULATED_VALUES = 20000000
+
+# Most what-if scenarios compared in one request. The baseline's and scenarios' simulations share MAX_SIMULATED_VALUES.
+MAX_SCENARIOS = 10
+
+# Technical indicators that can be computed, and those that need high/low prices as well as closes
+SUPPORTED_INDICATORS = ("sma", "ema", "rsi", "macd", "bollinger", "atr", "stochastic")
+HIGH_LOW_INDICATORS = ("atr", "stochastic")
+
+# Default keyword rules for categorizing transaction descriptions
+CATEGORY_RULES = {
+    "Groceries": ["grocery", "supermarket", "market", "carrefour", "naivas", "walmart", "aldi"],
+    "Dining": ["restaurant", "cafe", "coffee", "pizza", "burger", "kfc", "mcdonald", "starbucks"],
+    "Transport": ["uber", "bolt", "taxi", "fuel", "petrol", "shell", "parking", "bus", "train"],
+    "Utilities": ["electricity", "water", "power", "internet", "airtime", "safaricom", "kplc"],
+    "Housing": ["rent", "mortgage", "landlord"],
+    "Entertainment": ["netflix", "spotify", "cinema", "showmax", "steam"],
+    "Health": ["pharmacy", "hospital", "clinic", "dental", "chemist"],
+    "Shopping": ["amazon", "jumia", "store", "mall"],
+    "Income": ["salary", "payroll", "dividend", "interest"],
+    "Transfers": ["transfer", "mpesa", "withdrawal", "deposit"],
+}
+
+# Per-user corrections of normalized descriptions to categories, oldest evicted first
+MAX_CORRECTIONS_PER_USER = 1000
+user_category_corrections = {}
+
+# Preset calibration profiles: an adjustment to annual return assumptions and a multiplier for volatility
+CALIBRATION_PROFILES = {
+    "conservative": {"return_adjustment": -0.02, "volatility_multiplier": 1.25},
+    "base": {"return_adjustment": 0.0, "volatility_multiplier": 1.0},
+    "aggressive": {"return_adjustment": 0.01, "volatility_multiplier": 0.9},
+}
+
+# Per-user calibration profiles applied to goal, retirement and portfolio projections
+user_calibration_profiles = {}
+
+# Minimum corrections before a user's learned model is used, and the confidence it needs to override the rules
+MIN_CORRECTIONS_FOR_MODEL = 5
+MIN_MODEL_CONFIDENCE = 0.6
+
+# Recurring cadences as (typical days between occurrences, tolerance in days)
+RECURRING_CADENCES = {"weekly": (7, 1), "biweekly": (14, 2), "monthly": (30, 4)}
+
+# Minimum occurrences before a transaction is treated as recurring
+MIN_RECURRING_OCCURRENCES = 3
+
+# Asset classes with their own forecasting defaults. Crypto trades every day of the year, so daily crypto
+# prices annualize over 365 days and have distinct default horizons per frequency. Other series forecast
+# DEFAULT_SERIES_HORIZON periods when no horizon is requested.
+ASSET_CLASSES = ("equity", "crypto")
+TRADING_DAYS_PER_YEAR = {"equity": 252, "crypto": 365}
+DEFAULT_SERIES_HORIZON = 3
+CRYPTO_DEFAULT_HORIZONS = {"daily": [1, 7, 30, 90], "weekly": [1, 4, 12], "monthly": [1, 3, 6]}
+
+# Furthest horizon a series or its volatility can be forecast, in periods. Forecasts build and return a row per period.
+MAX_FORECAST_HORIZON = 1000
+
+# Fewest values any forecasting model can be fitted to
+MIN_FORECAST_VALUES = 2
+
+# Season length in periods for each input frequency, used by the seasonal naive model
+SEASONAL_PERIODS = {'ME': 12, 'W-SUN': 52, 'D': 7}
+
+# Methods available for forecasting spend per category
+BUDGET_METHODS = ("ets", "seasonal_naive")
+
+# Maximum number of batch forecasts fitted at the same time, and of series in one batch
+MAX_BATCH_CONCURRENCY = 4
+MAX_BATCH_PREDICTIONS = 50
+
+# Cached forecasts and correlation results keyed by a hash of their inputs, least recently used evicted first
+MAX_CACHED_FORECASTS = 500
+MAX_CACHED_CORRELATIONS = 200
+forecast_cache = OrderedDict()
+correlation_cache = OrderedDict()
+cache_lock = threading.Lock()
+
+# Issued predictions kept in memory for retrieval by ID, oldest evicted first
+MAX_STORED_PREDICTIONS = 1000
+prediction_store = {}
+
+# Background jobs kept in memory for status polling, oldest finished job evicted first, and the workers that run them
+JOB_WORKERS = 2
+MAX_STORED_JOBS = 1000
+job_store = {}
+job_events = {}
+job_queue = None
+job_workers = []
+
+# Open job WebSocket connections by connection ID, for the admin connection endpoints
+job_connections = {}
+
+# In-flight job webhook deliveries, and how long shutdown waits for them to finish
+webhook_deliveries = set()
+WEBHOOK_SHUTDOWN_SECONDS = 10
+
+# Whether to fit each model once at startup, and whether the service has finished starting up
+WARMUP_ON_STARTUP = os.environ.get("WARMUP_ON_STARTUP", "true").lower() != "false"
+WARMUP_SERIES_LENGTH = 24
+service_state = {"ready": False, "warmed_up_models": [], "warm_up_seconds": None}
+
+# Signed callbacks POSTed when background jobs finish, to the job's callback URL or the default backend URL
+WEBHOOK_URL = os.environ.get("WEBHOOK_URL")
+WEBHOOK_SECRET = os.environ.get("WEBHOOK_SECRET")
+WEBHOOK_ATTEMPTS = 3
+WEBHOOK_TIMEOUT = 10
 
 
 # Function to create a dataframe for Prophet
@@ -54,12 +997,267 @@ def get_holidays(country: str):
 def apply_tax_deductions(incomes: list, tax_rate: float):
     return [income * (1 - tax_rate) for income in incomes]
 
+# Auto-ARIMA forecasting: fit a small grid of (p, d, q) orders and keep the one with the lowest AIC
+def forecast_arima(dates, values, prediction_period, confidence_level=0.8, max_p=2, max_d=1, max_q=2):
+    series = pd.Series(values, index=dates, dtype=float)
+
+    best_fit = None
+    for order in itertools.product(range(max_p + 1), range(max_d + 1), range(max_q + 1)):
+        try:
+            # Statsmodels is noisy about convergence on short series, so silence its warnings
+            with warnings.catch_warnings():
+                warnings.simplefilter("ignore")
+                fit = ARIMA(series, order=order).fit()
+        except Exception:
+            continue
+        if best_fit is None or fit.aic < best_fit.aic:
+            best_fit = fit
+
+    if best_fit is None:
+        raise InputError("model_fit_failed", "Unable to fit an ARIMA model to the provided data", 422)
+
+    forecast = best_fit.get_forecast(steps=prediction_period)
+    conf_int = forecast.conf_int(alpha=1 - confidence_level)
+
+    return format_forecast(
+        get_future_dates(dates, prediction_period),
+        forecast.predicted_mean.values, conf_int.iloc[:, 0].values, conf_int.iloc[:, 1].values
+    )
+
+# Helper to detect the dominant seasonal period from the autocorrelation of the differenced series
+def detect_seasonal_period(values, min_strength=0.3):
+    series = pd.Series(values, dtype=float).diff().dropna()
+    best_period, best_strength = None, min_strength
+
+    # Only consider periods with at least two full cycles in the data
+    for lag in range(2, len(values) // 2 + 1):
+        strength = series.autocorr(lag=lag)
+        if pd.notna(strength) and strength > best_strength:
+            best_period, best_strength = lag, strength
+
+    return best_period
+
+# Holt-Winters (triple exponential smoothing) forecasting, a lightweight option for short histories
+def forecast_holt_winters(dates, values, prediction_period, confidence_level=0.8, trend='add', damped_trend=False, seasonal_period=None):
+    series = pd.Series(values, index=dates, dtype=float)
+    seasonal_period = seasonal_period or detect_seasonal_period(values)
+
+    try:
+        with warnings.catch_warnings():
+            warnings.simplefilter("ignore")
+            fit = ExponentialSmoothing(
+                series,
+                trend=trend,
+                damped_trend=damped_trend,
+                seasonal='add' if seasonal_period else None,
+                seasonal_periods=seasonal_period
+            ).fit()
+    except Exception:
+        raise InputError("model_fit_failed", "Unable to fit a Holt-Winters model to the provided data", 422)
+
+    yhat = fit.forecast(prediction_period).values
+
+    # Holt-Winters has no closed-form intervals, so widen the in-sample residual spread with the horizon
+    residual_std = fit.resid.std()
+    if pd.isna(residual_std):
+        residual_std = 0.0
+    spread = NormalDist().inv_cdf(0.5 + confidence_level / 2) * residual_std * np.sqrt(np.arange(1, prediction_period + 1))
+
+    return format_forecast(get_future_dates(dates, prediction_period), yhat, yhat - spread, yhat + spread)
+
+# Seasonal naive forecasting: repeat the value from one season earlier (a year for monthly data),
+# or the last value if there isn't a full season of history
+def forecast_seasonal_naive(dates, values, prediction_period, confidence_level=0.8, season=None):
+    history = np.asarray(values, dtype=float)
+    season = season or SEASONAL_PERIODS.get(dates.freqstr, 1)
+    if len(history) <= season:
+        season = 1
+
+    steps = np.arange(prediction_period)
+    yhat = history[len(history) - season + steps % season]
+
+    # Intervals widen with the number of seasons ahead, based on the spread of the seasonal differences
+    residual_std = np.std(history[season:] - history[:-season], ddof=1) if len(history) > season + 1 else 0.0
+    spread = NormalDist().inv_cdf(0.5 + confidence_level / 2) * residual_std * np.sqrt(steps // season + 1)
+
+    return format_forecast(get_future_dates(dates, prediction_period), yhat, yhat - spread, yhat + spread)
+
+# Helper to continue the input dates at the same frequency for the forecast periods
+def get_future_dates(dates, prediction_period):
+    return pd.date_range(start=dates[-1], periods=prediction_period + 1, freq=dates.freq)[1:]
+
+# Helper to shape forecast values into the same records Prophet forecasts return
+def format_forecast(future_dates, yhat, yhat_lower, yhat_upper):
+    return pd.DataFrame({
+        'ds': future_dates.strftime('%Y-%m-%d'),
+        'yhat': yhat,
+        'yhat_lower': yhat_lower,
+        'yhat_upper': yhat_upper
+    }).to_dict(orient='records')
+
+# Registry of alternative forecasting models, keyed by the name used in the request's "model" field
+MODEL_REGISTRY = {
+    "arima": forecast_arima,
+    "holt_winters": forecast_holt_winters,
+    "seasonal_naive": forecast_seasonal_naive,
+}
+
+# Virtual model combining the forecasts of other models with the weights of its registered version
+ENSEMBLE_MODEL = "ensemble"
+DEFAULT_ENSEMBLE_WEIGHTS = {"arima": 0.4, "holt_winters": 0.4, "seasonal_naive": 0.2}
+
+# Forecasting models that can be selected per request, Prophet being the default
+SUPPORTED_MODELS = ("prophet",) + tuple(MODEL_REGISTRY) + (ENSEMBLE_MODEL,)
+
+# Registered versions of each forecasting model, seeded with the built-in defaults, and the active version per model
+model_versions = {
+    name: {
+        "1": {
+            "name": name,
+            "version": "1",
+            "asset_classes": [],
+            "hyperparameters": {},
+            "artifact_location": None,
+            "use_sentiment": False,
+            "fallback_model": None,
+            "registered_at": datetime.now(timezone.utc).isoformat()
+        }
+    }
+    for name in SUPPORTED_MODELS
+}
+model_versions[ENSEMBLE_MODEL]["1"]["hyperparameters"] = {"weights": DEFAULT_ENSEMBLE_WEIGHTS}
+active_model_versions = {name: "1" for name in SUPPORTED_MODELS}
+
+# Candidate versions run in shadow mode next to each model's active version, and their forecasts by the ID of the
+# served prediction they shadow. Shadow forecasts are never returned to clients, only scored and compared.
+shadow_model_versions = {}
+shadow_predictions = {}
+shadow_runs = set()
+
+# A model version is flagged as drifted when its MAPE over the latest scored predictions exceeds its
+# backtest MAPE by this factor
+DRIFT_WINDOW = 20
+DRIFT_MIN_PREDICTIONS = 5
+DRIFT_THRESHOLD = 1.5
+
+# Hyperparameters each model accepts per registered version. Numbers are (type, minimum),
+# strings are a tuple of the allowed values. "lookback" limits fitting to the latest values.
+MODEL_HYPERPARAMETERS = {
+    "prophet": {
+        "lookback": (int, 2),
+        "changepoint_prior_scale": (float, 0.001),
+        "seasonality_prior_scale": (float, 0.001),
+        "seasonality_mode": ("additive", "multiplicative")
+    },
+    "arima": {"lookback": (int, 2), "max_p": (int, 0), "max_d": (int, 0), "max_q": (int, 0)},
+    "holt_winters": {"lookback": (int, 2), "trend": ("add", "mul"), "damped_trend": bool, "seasonal_period": (int, 2)},
+    "seasonal_naive": {"lookback": (int, 2), "season": (int, 1)},
+    ENSEMBLE_MODEL: {"lookback": (int, 2), "weights": dict},
+}
+
+# Helper to validate a model version's hyperparameters against what the model accepts
+def validate_hyperparameters(model_name, hyperparameters):
+    rules = MODEL_HYPERPARAMETERS[model_name]
+    for name, value in hyperparameters.items():
+        rule = rules.get(name)
+        if rule is None:
+            raise InputError("invalid_hyperparameters", f"Unknown hyperparameter {name} for model {model_name}")
+        if rule in (bool, dict):
+            if not isinstance(value, rule):
+                raise InputError("invalid_hyperparameters", f"Hyperparameter {name} must be a {rule.__name__}")
+        elif isinstance(rule[0], str):
+            if value not in rule:
+                raise InputError("invalid_hyperparameters", f"Hyperparameter {name} must be one of: {', '.join(rule)}")
+        else:
+            kind, minimum = rule
+            if isinstance(value, bool) or not isinstance(value, (int, float)) or (kind is int and value != int(value)):
+                raise InputError("invalid_hyperparameters", f"Hyperparameter {name} must be {'an integer' if kind is int else 'a number'}")
+            if value < minimum:
+                raise InputError("invalid_hyperparameters", f"Hyperparameter {name} must be at least {minimum}")
+
+    # Integer hyperparameters such as lookback are used to slice and index, so whole floats become ints
+    hyperparameters = {
+        name: int(value) if isinstance(rules[name], tuple) and rules[name][0] is int else value
+        for name, value in hyperparameters.items()
+    }
+    if model_name == ENSEMBLE_MODEL:
+        return {**hyperparameters, "weights": normalize_ensemble_weights(hyperparameters.get("weights"))}
+    return hyperparameters
+
+# Helper to validate ensemble weights and normalize them to sum to 1
+def normalize_ensemble_weights(weights):
+    if not weights:
+        raise InputError("invalid_ensemble_weights", "Ensemble weights are required")
+    if not isinstance(weights, dict):
+        raise InputError("invalid_ensemble_weights", "Ensemble weights must map member models to weights")
+    for member, weight in weights.items():
+        if member not in SUPPORTED_MODELS or member == ENSEMBLE_MODEL:
+            raise InputError("invalid_ensemble_weights", f"Unsupported ensemble member: {member}")
+        if isinstance(weight, bool) or not isinstance(weight, (int, float)) or not math.isfinite(weight):
+            raise InputError("invalid_ensemble_weights", f"Ensemble weight for {member} must be a number")
+        if weight < 0:
+            raise InputError("invalid_ensemble_weights", "Ensemble weights can't be negative")
+
+    total = sum(weights.values())
+    if total <= 0:
+        raise InputError("invalid_ensemble_weights", "Ensemble weights must sum to more than 0")
+    return {member: weight / total for member, weight in weights.items()}
+
+# Prophet forecast columns that make up the decomposition of each prediction
+FORECAST_COMPONENTS = ('trend', 'weekly', 'yearly', 'monthly', 'holidays', 'sentiment')
+
+# Explain each Prophet forecast as a baseline (the fitted trend at the last observed date) plus the contribution
+# of each feature: the change in trend since then, each seasonality and holidays, largest first
+def explain_prophet_forecast(forecast, history_length, prediction_period):
+    baseline = float(forecast['trend'].iloc[history_length - 1])
+    features = [component for component in FORECAST_COMPONENTS if component != 'trend' and component in forecast.columns]
+
+    explanations = []
+    for _, row in forecast.tail(prediction_period).iterrows():
+        contributions = {"trend": float(row['trend']) - baseline}
+        contributions.update({f"{feature}_seasonality" if feature != 'holidays' else feature: float(row[feature]) for feature in features})
+        explanations.append({
+            "baseline": baseline,
+            "top_features": [
+                {"feature": feature, "contribution": contribution}
+                for feature, contribution in sorted(contributions.items(), key=lambda item: -abs(item[1]))
+            ]
+        })
+
+    return explanations
+
+# Helper to reject series too short for the models to fit
+def validate_series_length(values):
+    if len(values) < MIN_FORECAST_VALUES:
+        raise InputError("insufficient_history", f"At least {MIN_FORECAST_VALUES} values are required to forecast a series", 422)
+
 # General Forecasting Function for Incomes/Expenses with optional seasonality and holidays
-def forecast_data(dates, values, country, prediction_period, enable_seasonality, enable_holidays, tax_deductions=False, tax_rate=0.1):
+def forecast_data(dates, values, country, prediction_period, enable_seasonality, enable_holidays, tax_deductions=False, tax_rate=0.1, model_name="prophet", include_components=False, confidence_level=0.8, include_explanations=False, sentiment=None, hyperparameters=None):
+    hyperparameters = dict(hyperparameters or {})
+
+    # Only fit on the latest values if the model version sets a lookback
+    lookback = hyperparameters.pop("lookback", None)
+    if lookback and len(values) > lookback:
+        if sentiment is not None:
+            sentiment = sentiment[len(values) - lookback:]
+        dates, values = dates[-lookback:], values[-lookback:]
+    validate_series_length(values)
+
+    # Combine several models if the ensemble is requested
+    if model_name == ENSEMBLE_MODEL:
+        return forecast_ensemble(
+            dates, values, country, prediction_period, enable_seasonality, enable_holidays, tax_deductions, tax_rate,
+            confidence_level, hyperparameters.get("weights") or DEFAULT_ENSEMBLE_WEIGHTS
+        )
+
+    # Use a registered model instead of Prophet if requested
+    if model_name in MODEL_REGISTRY:
+        return MODEL_REGISTRY[model_name](dates, values, prediction_period, confidence_level, **hyperparameters)
+
     df = create_dataframe(dates, values)
 
     # Instantiate a new Prophet model for each request
-    model = Prophet()
+    model = Prophet(interval_width=confidence_level, **hyperparameters)
 
     # Apply tax deduction if enabled
     if tax_deductions:
@@ -75,16 +1273,90 @@ def forecast_data(dates, values, country, prediction_period, enable_seasonality,
         if not holidays_df.empty:
             model = model.add_country_holidays(country_name=country)
 
+    # Add sentiment as an extra regressor if provided. Future periods without a score hold the last known score.
+    if sentiment is not None:
+        model.add_regressor('sentiment')
+        df['sentiment'] = sentiment[:len(df)]
+
     model.fit(df)
-    future = model.make_future_dataframe(periods=prediction_period, freq='ME')
+    future = model.make_future_dataframe(periods=prediction_period, freq=dates.freq)
+    if sentiment is not None:
+        future['sentiment'] = list(sentiment) + [sentiment[-1]] * (len(future) - len(sentiment))
     forecast = model.predict(future)
 
     # Format the 'ds' column to only return the date in YYYY-MM-DD format
     forecast['ds'] = forecast['ds'].dt.strftime('%Y-%m-%d')
 
-    return forecast[['ds', 'yhat', 'yhat_lower', 'yhat_upper']].tail(prediction_period).to_dict(orient='records')
+    columns = ['ds', 'yhat', 'yhat_lower', 'yhat_upper']
+
+    # Add the components Prophet fitted (trend, seasonalities, holidays) if requested
+    if include_components:
+        columns += [component for component in FORECAST_COMPONENTS if component in forecast.columns]
+
+    records = forecast[columns].tail(prediction_period).to_dict(orient='records')
+
+    # Attach an explanation of the contributing features to each forecast if requested
+    if include_explanations:
+        for record, explanation in zip(records, explain_prophet_forecast(forecast, len(df), prediction_period)):
+            record['explanation'] = explanation
+
+    return records
+
+# Weighted ensemble: forecast with each member model and combine the forecasts (and their intervals) by weight
+def forecast_ensemble(dates, values, country, prediction_period, enable_seasonality, enable_holidays, tax_deductions, tax_rate, confidence_level, weights):
+    weights = normalize_ensemble_weights(weights)
+    forecasts = {
+        member: forecast_data(
+            dates, values, country, prediction_period, enable_seasonality, enable_holidays, tax_deductions, tax_rate,
+            model_name=member, confidence_level=confidence_level
+        )
+        for member in weights
+    }
 
-def forecast_savings(savings, start_date, prediction_period, country, enable_seasonality, enable_holidays):
+    records = []
+    for step in range(prediction_period):
+        record = {"ds": forecasts[next(iter(weights))][step]['ds']}
+        for column in ('yhat', 'yhat_lower', 'yhat_upper'):
+            record[column] = float(sum(weight * forecasts[member][step][column] for member, weight in weights.items()))
+        records.append(record)
+
+    return records
+
+# Helper to build a cache key by hashing everything that influences a result
+def get_cache_key(*inputs):
+    payload = json.dumps(inputs, default=str)
+    return hashlib.sha256(payload.encode()).hexdigest()
+
+# Helper to look up a cached result, marking it as recently used
+def get_cached_result(cache, key):
+    with cache_lock:
+        result = cache.get(key)
+        if result is not None:
+            cache.move_to_end(key)
+        return result
+
+# Helper to cache a result, evicting the least recently used entry when the cache is full
+def store_cached_result(cache, key, result, max_entries):
+    with cache_lock:
+        cache[key] = result
+        if len(cache) > max_entries:
+            cache.popitem(last=False)
+
+# Forecast through the cache so repeated requests over unchanged data don't refit the model.
+# New data changes the key, so stale forecasts are never served.
+def cached_forecast_data(dates, values, *args, **kwargs):
+    validate_series_length(values)
+    key = get_cache_key(str(dates[0]), dates.freqstr, list(values), args, sorted(kwargs.items()))
+
+    forecast = get_cached_result(forecast_cache, key)
+    if forecast is None:
+        forecast = forecast_data(dates, values, *args, **kwargs)
+        store_cached_result(forecast_cache, key, forecast, MAX_CACHED_FORECASTS)
+
+    # Hand out copies so callers can't modify the cached records
+    return [dict(record) for record in forecast]
+
+def forecast_savings(savings, start_date, prediction_period, country, enable_seasonality, enable_holidays, confidence_level=0.8):
     current_savings = savings.get('current_savings', 0)
     monthly_contribution = savings.get('monthly_contribution', 0)
     goal = savings.get('goal', 0)
@@ -96,7 +1368,7 @@ def forecast_savings(savings, start_date, prediction_period, country, enable_sea
     df = create_dataframe(dates, savings_values)
 
     # Instantiate a new Prophet model for each request
-    model = Prophet()
+    model = Prophet(interval_width=confidence_level)
 
     # Add holidays if enabled
     if enable_holidays:
@@ -120,59 +1392,1139 @@ def forecast_savings(savings, start_date, prediction_period, country, enable_sea
     return forecast[['ds', 'yhat', 'yhat_lower', 'yhat_upper', 'goal_met', 'surplus_or_deficit']].tail(prediction_period).to_dict(orient='records')
 
 
+# Helper to compute forecast error metrics. The previous values are the last known values when each
+# forecast was made, used to score the predicted direction and a simple long/short strategy.
+def compute_error_metrics(actuals, predictions, previous):
+    actuals, predictions, previous = np.array(actuals, dtype=float), np.array(predictions, dtype=float), np.array(previous, dtype=float)
+    errors = actuals - predictions
+    nonzero = actuals != 0
 
-# Helper to process the dates for input data
-def get_dates(start_date, frequency, length):
-    start = pd.to_datetime(start_date)
-    if frequency == "monthly":
-        return pd.date_range(start=start, periods=length, freq='ME')
-    elif frequency == "weekly":
-        return pd.date_range(start=start, periods=length, freq='W')
-    else:
-        logger.error("Unsupported frequency")
-        raise ValueError("Unsupported frequency")
+    # Go long when the model predicts a rise, short when it predicts a fall
+    positions = np.sign(predictions - previous)
 
+    return {
+        "mae": float(np.mean(np.abs(errors))),
+        "rmse": float(np.sqrt(np.mean(errors ** 2))),
+        "mape": float(np.mean(np.abs(errors[nonzero] / actuals[nonzero])) * 100) if nonzero.any() else None,
+        "direction_hit_rate": float(np.mean(positions == np.sign(actuals - previous))),
+        "strategy_pnl": float(np.sum(positions * (actuals - previous)))
+    }
 
-# Main prediction function using asyncio for parallelism
-async def process_predictions(data: PredictionRequest):
-    try:
-        tasks = []
+# Walk-forward backtest: refit on an expanding window at each step and score the forecast against the realized value
+def run_backtest(dates, values, model_name, initial_window, horizon, country, enable_seasonality, enable_holidays, hyperparameters=None):
+    steps = []
+    for end in range(initial_window, len(values) - horizon + 1):
+        forecast = forecast_data(
+            dates[:end], values[:end], country, horizon, enable_seasonality, enable_holidays, model_name=model_name,
+            hyperparameters=hyperparameters
+        )
+        steps.append({
+            "ds": forecast[-1]['ds'],
+            "previous": values[end - 1],
+            "actual": values[end + horizon - 1],
+            "predicted": forecast[-1]['yhat']
+        })
 
-        # Add expense prediction task if expenses data is provided
-        if data.expenses:
-            dates = get_dates(data.expenses_start_date or data.start_date, data.frequency, len(data.expenses))
-            tasks.append(asyncio.to_thread(
-                forecast_data, dates, data.expenses, data.country, data.prediction_period, 
-                data.enable_seasonality, data.enable_holidays, data.tax_deductions, data.tax_rate
-            ))
+    metrics = compute_error_metrics(
+        [step["actual"] for step in steps], [step["predicted"] for step in steps], [step["previous"] for step in steps]
+    )
+    return {"metrics": metrics, "steps": steps}
 
-        # Add income prediction task if incomes data is provided
-        if data.incomes:
-            dates = get_dates(data.incomes_start_date or data.start_date, data.frequency, len(data.incomes))
-            tasks.append(asyncio.to_thread(
-                forecast_data, dates, data.incomes, data.country, data.prediction_period, 
-                data.enable_seasonality, data.enable_holidays, data.tax_deductions, data.tax_rate
-            ))
+# Backtest each member model and weight it by inverse RMSE, so more accurate members count for more
+def tune_ensemble_weights(dates, values, members, initial_window, horizon, country, enable_seasonality, enable_holidays):
+    metrics = {
+        member: run_backtest(
+            dates, values, member, initial_window, horizon, country, enable_seasonality, enable_holidays
+        )["metrics"]
+        for member in members
+    }
 
-        # Add savings prediction task if savings data is provided
-        if data.savings:
-            dates = get_dates(data.savings_start_date or data.start_date, data.frequency, data.prediction_period)
-            tasks.append(asyncio.to_thread(
-                forecast_savings, data.savings, data.savings_start_date or data.start_date, data.prediction_period, 
-                data.country, data.enable_seasonality, data.enable_holidays
-            ))
+    # A member with no error on the backtest takes all the weight
+    perfect = [member for member in members if metrics[member]["rmse"] == 0]
+    if perfect:
+        weights = {member: (1.0 if member in perfect else 0.0) for member in members}
+    else:
+        weights = {member: 1 / metrics[member]["rmse"] for member in members}
 
-        # Run all the tasks concurrently and gather results
-        results = await asyncio.gather(*tasks)
+    return normalize_ensemble_weights(weights), metrics
 
-        # Initialize the result dictionary
-        result_dict = {
-            "expense_predictions": None,
-            "income_predictions": None,
-            "savings_predictions": None
-        }
+# Relative Strength Index using Wilder's smoothing
+def compute_rsi(close, period):
+    delta = close.diff()
+    gain = delta.clip(lower=0).ewm(alpha=1 / period, adjust=False).mean()
+    loss = (-delta.clip(upper=0)).ewm(alpha=1 / period, adjust=False).mean()
+    rsi = 100 - 100 / (1 + gain / loss)
+    rsi.iloc[:period] = np.nan
+    return rsi
 
-        result_index = 0
+# Average True Range using Wilder's smoothing
+def compute_atr(high, low, close, period):
+    previous_close = close.shift(1)
+    true_range = pd.concat([high - low, (high - previous_close).abs(), (low - previous_close).abs()], axis=1).max(axis=1)
+    atr = true_range.ewm(alpha=1 / period, adjust=False).mean()
+    atr.iloc[:period - 1] = np.nan
+    return atr
+
+# Compute the requested technical indicators over close (and optionally high/low) prices
+def compute_indicators(close, high, low, indicators, window, period, num_std):
+    close = pd.Series(close, dtype=float)
+    high = pd.Series(high, dtype=float) if high is not None else None
+    low = pd.Series(low, dtype=float) if low is not None else None
+    result = pd.DataFrame({'close': close})
+
+    if "sma" in indicators:
+        result['sma'] = close.rolling(window).mean()
+
+    if "ema" in indicators:
+        result['ema'] = close.ewm(span=window, adjust=False).mean()
+
+    if "rsi" in indicators:
+        result['rsi'] = compute_rsi(close, period)
+
+    # MACD uses the standard 12/26 EMAs with a 9-period signal line
+    if "macd" in indicators:
+        macd = close.ewm(span=12, adjust=False).mean() - close.ewm(span=26, adjust=False).mean()
+        result['macd'] = macd
+        result['macd_signal'] = macd.ewm(span=9, adjust=False).mean()
+        result['macd_histogram'] = macd - result['macd_signal']
+
+    if "bollinger" in indicators:
+        middle = close.rolling(window).mean()
+        spread = num_std * close.rolling(window).std(ddof=0)
+        result['bollinger_middle'] = middle
+        result['bollinger_upper'] = middle + spread
+        result['bollinger_lower'] = middle - spread
+
+    if "atr" in indicators:
+        result['atr'] = compute_atr(high, low, close, period)
+
+    # Stochastic oscillator %K over the period, with a 3-period %D signal line
+    if "stochastic" in indicators:
+        lowest_low = low.rolling(period).min()
+        highest_high = high.rolling(period).max()
+        result['stochastic_k'] = 100 * (close - lowest_low) / (highest_high - lowest_low)
+        result['stochastic_d'] = result['stochastic_k'].rolling(3).mean()
+
+    return result
+
+# Helper to make a dataframe JSON friendly by turning NaN/inf (e.g. during indicator warm-up) into None
+def to_json_records(df):
+    df = df.replace([np.inf, -np.inf], np.nan)
+    return df.astype(object).where(df.notna(), None).to_dict(orient='records')
+
+# Formats a training dataset can be exported in
+DATASET_FORMATS = ("csv", "json")
+
+# Build one row per symbol and date with lagged values, returns and rolling statistics as features and the
+# value `target_horizon` periods later as the target. Rows without a full set of features or a target are dropped.
+def build_training_dataset(series, frequency, lags, window, target_horizon, from_date=None, to_date=None):
+    frames = []
+    for item in series:
+        values = pd.Series(item.values, dtype=float)
+        frame = pd.DataFrame({
+            'symbol': item.symbol,
+            'ds': get_dates(item.start_date, frequency, len(values)),
+            'value': values
+        })
+        for lag in lags:
+            frame[f'lag_{lag}'] = values.shift(lag)
+        frame['return_1'] = values.pct_change()
+        frame[f'rolling_mean_{window}'] = values.rolling(window).mean()
+        frame[f'rolling_std_{window}'] = values.rolling(window).std()
+        frame['target'] = values.shift(-target_horizon)
+        frames.append(frame.replace([np.inf, -np.inf], np.nan).dropna())
+
+    dataset = pd.concat(frames, ignore_index=True)
+    if from_date:
+        dataset = dataset[dataset['ds'] >= parse_dates(from_date, "From date")]
+    if to_date:
+        dataset = dataset[dataset['ds'] <= parse_dates(to_date, "To date")]
+
+    dataset['ds'] = dataset['ds'].dt.strftime('%Y-%m-%d')
+    return dataset.sort_values(['symbol', 'ds']).reset_index(drop=True)
+
+# Flag values that deviate more than `threshold` standard deviations from the EWMA of the values before them.
+# Returns (index, z_score) pairs; the first `min_periods` values are never flagged.
+def detect_anomalies(values, threshold=3.0, span=10, min_periods=5):
+    series = pd.Series(values, dtype=float)
+    mean = series.ewm(span=span, min_periods=min_periods).mean().shift(1)
+    std = series.ewm(span=span, min_periods=min_periods).std().shift(1).replace(0, np.nan)
+    z_scores = (series - mean) / std
+    return [(index, float(z)) for index, z in z_scores.items() if abs(z) > threshold]
+
+# Helper to replace anomalous values with values interpolated from their neighbors
+def remove_anomalies(values, threshold=3.0):
+    series = pd.Series(values, dtype=float)
+    for index, _ in detect_anomalies(values, threshold):
+        series.iloc[index] = np.nan
+    return series.interpolate(limit_direction='both').tolist()
+
+# Helper to compute periodic returns from price histories, aligned on the most recent periods they all have in common
+def get_aligned_returns(price_histories):
+    length = min(len(prices) for prices in price_histories)
+    if length < 3:
+        raise InputError("insufficient_history", "At least 3 prices per position are required to estimate returns", 422)
+
+    prices = pd.DataFrame({i: list(history)[-length:] for i, history in enumerate(price_histories)}, dtype=float)
+    return prices.pct_change().dropna()
+
+# Estimate mean periodic returns and their covariance from price histories
+def estimate_return_statistics(price_histories):
+    returns = get_aligned_returns(price_histories)
+    return returns.mean().values, np.atleast_2d(returns.cov().values)
+
+# Simulate buy-and-hold portfolio values with multivariate normal periodic returns.
+# Returns an array of shape (simulations, periods) holding the total portfolio value at the end of each period.
+def simulate_portfolio_paths(initial_values, mean_returns, covariance, periods, simulations, seed=None):
+    rng = np.random.default_rng(seed)
+    returns = rng.multivariate_normal(mean_returns, covariance, size=(simulations, periods))
+
+    # A position can't lose more than its whole value in one period
+    growth = np.cumprod(np.maximum(1 + returns, 0), axis=1)
+
+    return (growth * np.asarray(initial_values, dtype=float)).sum(axis=2)
+
+# Helper to summarize simulated portfolio values at each requested horizon
+def summarize_simulations(paths, horizons, percentiles, initial_value):
+    return [
+        {
+            "horizon": horizon,
+            "mean": float(paths[:, horizon - 1].mean()),
+            "probability_of_loss": float((paths[:, horizon - 1] < initial_value).mean()),
+            "percentiles": {
+                str(percentile): float(value)
+                for percentile, value in zip(percentiles, np.percentile(paths[:, horizon - 1], percentiles))
+            }
+        }
+        for horizon in sorted(set(horizons))
+    ]
+
+# Monte Carlo projection of a portfolio's value over the requested horizons
+def project_portfolio(positions, horizons, simulations, percentiles, seed=None, return_adjustment=0.0, volatility_multiplier=1.0):
+    mean_returns, covariance = estimate_return_statistics([position.prices for position in positions])
+    mean_returns, covariance = mean_returns + return_adjustment, covariance * volatility_multiplier ** 2
+    initial_values = [position.value for position in positions]
+    initial_value = sum(initial_values)
+
+    paths = simulate_portfolio_paths(initial_values, mean_returns, covariance, max(horizons), simulations, seed)
+
+    return {
+        "initial_value": initial_value,
+        "simulations": simulations,
+        "projections": summarize_simulations(paths, horizons, percentiles, initial_value)
+    }
+
+# Volatility models accepted by the risk endpoint
+VOLATILITY_MODELS = ("historical", "garch")
+MIN_GARCH_RETURNS = 30
+
+# Fit a GARCH(1,1) model, sigma2[t] = omega + alpha * e[t-1]^2 + beta * sigma2[t-1], by maximum likelihood.
+# Returns the fitted parameters and the conditional variance for the period after the last return.
+def fit_garch(returns):
+    returns = np.asarray(returns, dtype=float)
+    if len(returns) < MIN_GARCH_RETURNS:
+        raise InputError("insufficient_history", f"At least {MIN_GARCH_RETURNS} returns are required to fit a GARCH model", 422)
+
+    mean = returns.mean()
+    residuals = returns - mean
+    sample_variance = max(residuals.var(), 1e-12)
+
+    def conditional_variances(params):
+        omega, alpha, beta = params
+        variances = np.empty(len(residuals) + 1)
+        variances[0] = sample_variance
+        for t in range(1, len(variances)):
+            variances[t] = omega + alpha * residuals[t - 1] ** 2 + beta * variances[t - 1]
+        return variances
+
+    def negative_log_likelihood(params):
+        variances = np.maximum(conditional_variances(params)[:-1], 1e-12)
+        return 0.5 * np.sum(np.log(variances) + residuals ** 2 / variances)
+
+    result = minimize(
+        negative_log_likelihood,
+        np.array([sample_variance * 0.1, 0.1, 0.8]),
+        method="SLSQP",
+        bounds=[(1e-12, None), (0, 1), (0, 1)],
+        constraints=[{"type": "ineq", "fun": lambda params: 0.999 - params[1] - params[2]}]
+    )
+    if not result.success:
+        raise InputError("model_fit_failed", f"GARCH fit failed: {result.message}", 422)
+
+    omega, alpha, beta = result.x
+    return {"mean": mean, "omega": omega, "alpha": alpha, "beta": beta}, conditional_variances(result.x)[-1]
+
+# Forecast per-period variances for the next `horizon` periods from a fitted GARCH(1,1) model.
+# Forecasts revert from the next-period variance towards the long-run variance at rate alpha + beta.
+def forecast_garch_variances(params, next_variance, horizon):
+    persistence = params["alpha"] + params["beta"]
+    long_run_variance = params["omega"] / (1 - persistence)
+    steps = np.arange(horizon)
+    return long_run_variance + persistence ** steps * (next_variance - long_run_variance), long_run_variance
+
+# Forward volatility estimates for each asset, with a forecast price range and an elevated-volatility flag
+def forecast_volatility(assets, horizon, periods_per_year, confidence_level, elevated_threshold):
+    z = NormalDist().inv_cdf(0.5 + confidence_level / 2)
+    results = []
+    for asset in assets:
+        prices = np.asarray(asset.prices, dtype=float)
+        returns = np.diff(np.log(prices))
+        params, next_variance = fit_garch(returns)
+        variances, long_run_variance = forecast_garch_variances(params, next_variance, horizon)
+
+        horizon_volatility = float(np.sqrt(variances.sum()))
+        long_run_volatility = float(np.sqrt(long_run_variance))
+        current_volatility = float(np.sqrt(variances[0]))
+        volatility_ratio = safe_ratio(np.sqrt(variances.mean()), long_run_volatility)
+
+        results.append({
+            "symbol": asset.symbol,
+            "parameters": {key: float(value) for key, value in params.items()},
+            "current_volatility": current_volatility,
+            "long_run_volatility": long_run_volatility,
+            "annualized_volatility": float(np.sqrt(variances.mean() * periods_per_year)),
+            "horizon_volatility": horizon_volatility,
+            "volatility_path": [float(value) for value in np.sqrt(variances)],
+            "price_range": {
+                "lower": float(prices[-1] * np.exp(-z * horizon_volatility)),
+                "upper": float(prices[-1] * np.exp(z * horizon_volatility))
+            },
+            "elevated_volatility_expected": volatility_ratio is not None and volatility_ratio >= elevated_threshold
+        })
+
+    return {"horizon": horizon, "confidence_level": confidence_level, "volatility": results}
+
+# Historical and parametric (normal) Value-at-Risk and CVaR of a portfolio, as positive loss amounts.
+# Multi-period figures are scaled from single-period returns using the square-root-of-time rule.
+# With the "garch" volatility model, GARCH figures use the forecast variance over the horizon instead.
+def compute_value_at_risk(positions, confidence_levels, horizon, volatility_model="historical"):
+    returns = get_aligned_returns([position.prices for position in positions])
+    values = np.array([position.value for position in positions], dtype=float)
+    portfolio_value = values.sum()
+    portfolio_returns = returns.values @ (values / portfolio_value)
+
+    mean, std = portfolio_returns.mean(), portfolio_returns.std(ddof=1)
+    scale = np.sqrt(horizon)
+
+    garch_std = None
+    if volatility_model == "garch":
+        params, next_variance = fit_garch(portfolio_returns)
+        garch_std = np.sqrt(forecast_garch_variances(params, next_variance, horizon)[0].sum())
+
+    results = []
+    for confidence_level in confidence_levels:
+        cutoff = np.percentile(portfolio_returns, (1 - confidence_level) * 100)
+        tail = portfolio_returns[portfolio_returns <= cutoff]
+        z = NormalDist().inv_cdf(1 - confidence_level)
+
+        result = {
+            "confidence_level": confidence_level,
+            "historical_var": float(-cutoff * scale * portfolio_value),
+            "historical_cvar": float(-tail.mean() * scale * portfolio_value),
+            "parametric_var": float(-(mean * horizon + z * std * scale) * portfolio_value),
+            "parametric_cvar": float(
+                -(mean * horizon - std * scale * NormalDist().pdf(z) / (1 - confidence_level)) * portfolio_value
+            )
+        }
+        if garch_std is not None:
+            result["garch_var"] = float(-(mean * horizon + z * garch_std) * portfolio_value)
+            result["garch_cvar"] = float(
+                -(mean * horizon - garch_std * NormalDist().pdf(z) / (1 - confidence_level)) * portfolio_value
+            )
+        results.append(result)
+
+    return {"portfolio_value": float(portfolio_value), "horizon": horizon, "value_at_risk": results}
+
+# Helper to divide without producing inf/NaN, which can't be returned as JSON
+def safe_ratio(numerator, denominator):
+    return float(numerator / denominator) if denominator else None
+
+# Annualized Sharpe and Sortino ratios, maximum drawdown and (optionally) beta for a series of periodic returns
+def compute_performance_metrics(returns, risk_free_rate, periods_per_year, benchmark_returns=None):
+    excess = returns - risk_free_rate / periods_per_year
+    downside_deviation = np.sqrt(np.mean(np.minimum(excess, 0) ** 2))
+
+    growth = np.cumprod(1 + returns)
+    drawdowns = growth / np.maximum.accumulate(growth) - 1
+
+    metrics = {
+        "annualized_return": float((growth[-1] ** (periods_per_year / len(returns))) - 1),
+        "annualized_volatility": float(returns.std(ddof=1) * np.sqrt(periods_per_year)),
+        "sharpe_ratio": safe_ratio(excess.mean() * np.sqrt(periods_per_year), returns.std(ddof=1)),
+        "sortino_ratio": safe_ratio(excess.mean() * np.sqrt(periods_per_year), downside_deviation),
+        "max_drawdown": float(drawdowns.min())
+    }
+
+    if benchmark_returns is not None:
+        metrics["beta"] = safe_ratio(np.cov(returns, benchmark_returns)[0, 1], benchmark_returns.var(ddof=1))
+
+    return metrics
+
+# Performance metrics for each position and for the portfolio held at its current weights
+def compute_portfolio_metrics(positions, benchmark_prices, risk_free_rate, periods_per_year):
+    histories = [position.prices for position in positions]
+    if benchmark_prices is not None:
+        histories.append(benchmark_prices)
+
+    returns = get_aligned_returns(histories).values
+    benchmark_returns = returns[:, -1] if benchmark_prices is not None else None
+
+    values = np.array([position.value for position in positions], dtype=float)
+    portfolio_returns = returns[:, :len(positions)] @ (values / values.sum())
+
+    return {
+        "portfolio": compute_performance_metrics(portfolio_returns, risk_free_rate, periods_per_year, benchmark_returns),
+        "positions": [
+            {
+                "symbol": position.symbol,
+                **compute_performance_metrics(returns[:, i], risk_free_rate, periods_per_year, benchmark_returns)
+            }
+            for i, position in enumerate(positions)
+        ]
+    }
+
+# Find long-only (or bounded) portfolio weights that sum to 1 and optimize the requested objective
+# over annualized mean returns and covariance
+def optimize_weights(mean_returns, covariance, objective, risk_free_rate, weight_bounds, target_return=None):
+    asset_count = len(mean_returns)
+
+    def variance(weights):
+        return weights @ covariance @ weights
+
+    def negative_sharpe(weights):
+        return -(weights @ mean_returns - risk_free_rate) / np.sqrt(max(variance(weights), 1e-12))
+
+    constraints = [{"type": "eq", "fun": lambda weights: weights.sum() - 1}]
+    if objective == "target_return":
+        constraints.append({"type": "eq", "fun": lambda weights: weights @ mean_returns - target_return})
+
+    result = minimize(
+        negative_sharpe if objective == "max_sharpe" else variance,
+        np.full(asset_count, 1 / asset_count),
+        method="SLSQP",
+        bounds=[weight_bounds] * asset_count,
+        constraints=constraints
+    )
+    if not result.success:
+        raise InputError("optimization_failed", f"Optimization failed: {result.message}", 422)
+
+    return result.x
+
+# Helper to describe a set of weights with its expected annual return, volatility and Sharpe ratio
+def describe_allocation(symbols, weights, mean_returns, covariance, risk_free_rate):
+    expected_return = float(weights @ mean_returns)
+    volatility = float(np.sqrt(max(weights @ covariance @ weights, 0)))
+    return {
+        "weights": {symbol: float(weight) for symbol, weight in zip(symbols, weights)},
+        "expected_return": expected_return,
+        "volatility": volatility,
+        "sharpe_ratio": safe_ratio(expected_return - risk_free_rate, volatility)
+    }
+
+# Mean-variance optimization of the provided assets, optionally with points along the efficient frontier
+def optimize_portfolio(assets, objective, target_return, risk_free_rate, periods_per_year, weight_bounds, frontier_points):
+    symbols = [asset.symbol for asset in assets]
+    mean_returns, covariance = estimate_return_statistics([asset.prices for asset in assets])
+    mean_returns, covariance = mean_returns * periods_per_year, covariance * periods_per_year
+
+    weights = optimize_weights(mean_returns, covariance, objective, risk_free_rate, weight_bounds, target_return)
+    result = {
+        "objective": objective,
+        "allocation": describe_allocation(symbols, weights, mean_returns, covariance, risk_free_rate)
+    }
+
+    # Trace the frontier from the minimum-variance portfolio up to the best single-asset return
+    if frontier_points:
+        min_variance_weights = optimize_weights(mean_returns, covariance, "min_variance", risk_free_rate, weight_bounds)
+        frontier = []
+        for target in np.linspace(min_variance_weights @ mean_returns, mean_returns.max(), frontier_points):
+            try:
+                frontier_weights = optimize_weights(
+                    mean_returns, covariance, "target_return", risk_free_rate, weight_bounds, target
+                )
+            except ValueError:
+                continue
+            frontier.append(describe_allocation(symbols, frontier_weights, mean_returns, covariance, risk_free_rate))
+        result["efficient_frontier"] = frontier
+
+    return result
+
+# Compare current weights to the targets and plan the trades that bring the portfolio back to them
+def compute_rebalance_plan(holdings, target_weights, cash, drift_threshold, transaction_cost_rate, fixed_cost_per_trade):
+    values = {}
+    for holding in holdings:
+        values[holding.symbol] = values.get(holding.symbol, 0) + holding.value
+    total_value = sum(values.values()) + cash
+
+    drifts, trades = [], []
+    for symbol in sorted(set(values) | set(target_weights)):
+        current_value = values.get(symbol, 0)
+        current_weight = current_value / total_value
+        target_weight = target_weights.get(symbol, 0)
+        drifts.append({
+            "symbol": symbol,
+            "current_weight": current_weight,
+            "target_weight": target_weight,
+            "drift": current_weight - target_weight
+        })
+
+        # Positive amounts are buys and negative amounts are sells
+        amount = target_weight * total_value - current_value
+        if abs(amount) >= 0.01:
+            trades.append({
+                "symbol": symbol,
+                "action": "buy" if amount > 0 else "sell",
+                "amount": abs(amount),
+                "estimated_cost": abs(amount) * transaction_cost_rate + fixed_cost_per_trade
+            })
+
+    max_drift = max(abs(drift["drift"]) for drift in drifts)
+    return {
+        "total_value": total_value,
+        "max_drift": max_drift,
+        "rebalance_recommended": max_drift > drift_threshold,
+        "drifts": drifts,
+        "trades": trades,
+        "turnover": sum(trade["amount"] for trade in trades) / 2,
+        "total_estimated_cost": sum(trade["estimated_cost"] for trade in trades)
+    }
+
+# Pairwise return correlations and diversification measures over each lookback.
+# The diversification score maps the average pairwise correlation from [1, -1] onto [0, 100].
+def compute_correlations(symbols, price_histories, lookbacks, weights):
+    returns = get_aligned_returns(price_histories)
+    returns.columns = symbols
+    weights = np.array([weights.get(symbol, 0) for symbol in symbols]) if weights else np.full(len(symbols), 1 / len(symbols))
+
+    results = []
+    for lookback in lookbacks or [len(returns)]:
+        window = returns.tail(lookback)
+        correlations = window.corr()
+        pairs = correlations.values[np.triu_indices(len(symbols), k=1)]
+        average_correlation = float(np.nanmean(pairs)) if not np.isnan(pairs).all() else None
+        portfolio_volatility = np.sqrt(max(weights @ window.cov().values @ weights, 0))
+
+        results.append({
+            "lookback": len(window),
+            "correlation_matrix": {
+                symbol: {other: None if pd.isna(value) else float(value) for other, value in row.items()}
+                for symbol, row in correlations.iterrows()
+            },
+            "average_correlation": average_correlation,
+            "diversification_ratio": safe_ratio(weights @ window.std(ddof=1).values, portfolio_volatility),
+            "diversification_score": (1 - average_correlation) / 2 * 100 if average_correlation is not None else None
+        })
+
+    return {"correlations": results}
+
+# Simulate an account balance with periodic contributions and normally distributed periodic returns.
+# Contributions, mean returns and volatilities can be scalars or per-period sequences; balances never go below zero.
+# Returns an array of shape (simulations, periods) holding the balance at the end of each period.
+def simulate_balance_paths(initial_balance, contributions, mean_returns, volatilities, periods, simulations, seed=None):
+    rng = np.random.default_rng(seed)
+    contributions = np.broadcast_to(np.asarray(contributions, dtype=float), periods)
+    mean_returns = np.broadcast_to(np.asarray(mean_returns, dtype=float), periods)
+    volatilities = np.broadcast_to(np.asarray(volatilities, dtype=float), periods)
+    shocks = rng.standard_normal((simulations, periods))
+
+    paths = np.empty((simulations, periods))
+    balances = np.full(simulations, float(initial_balance))
+    for period in range(periods):
+        growth = 1 + mean_returns[period] + volatilities[period] * shocks[:, period]
+        balances = np.maximum(balances * growth + contributions[period], 0)
+        paths[:, period] = balances
+
+    return paths
+
+# Helper to convert an annual return and volatility into monthly ones
+def to_monthly(annual_return, annual_volatility):
+    return (1 + annual_return) ** (1 / 12) - 1, annual_volatility / np.sqrt(12)
+
+# Helper to compute the level contribution per period that grows a balance to a target at a fixed return
+def required_contribution(balance, target, periodic_return, periods):
+    if periodic_return == 0:
+        return max((target - balance) / periods, 0)
+    growth = (1 + periodic_return) ** periods
+    return max((target - balance * growth) * periodic_return / (growth - 1), 0)
+
+# Project a savings goal: Monte Carlo probability of success, balance percentiles and milestone timing
+def project_goal(current_balance, monthly_contribution, goal, months, expected_annual_return, annual_volatility, simulations, milestones, seed=None):
+    monthly_return, monthly_volatility = to_monthly(expected_annual_return, annual_volatility)
+    paths = simulate_balance_paths(
+        current_balance, monthly_contribution, monthly_return, monthly_volatility, months, simulations, seed
+    )
+    final_balances = paths[:, -1]
+
+    milestone_results = []
+    for share in milestones:
+        reached = paths >= share * goal
+        # Month by which half of the simulated paths have reached the milestone, if they do before the deadline
+        first_months = np.where(reached.any(axis=1), reached.argmax(axis=1) + 1, np.inf)
+        median_month = np.median(first_months)
+        milestone_results.append({
+            "share_of_goal": share,
+            "amount": share * goal,
+            "probability": float(reached.any(axis=1).mean()),
+            "median_month": int(median_month) if np.isfinite(median_month) else None
+        })
+
+    return {
+        "goal": goal,
+        "months": months,
+        "probability_of_success": float((final_balances >= goal).mean()),
+        "expected_final_balance": float(final_balances.mean()),
+        "final_balance_percentiles": {
+            str(percentile): float(value)
+            for percentile, value in zip((10, 50, 90), np.percentile(final_balances, (10, 50, 90)))
+        },
+        "required_monthly_contribution": float(required_contribution(current_balance, goal, monthly_return, months)),
+        "milestones": milestone_results
+    }
+
+# Project retirement readiness year by year: contributions grow until retirement, inflation-indexed spending is
+# withdrawn afterwards, and the stock allocation glides linearly from its start to its end value at retirement
+def project_retirement(data):
+    years = data.life_expectancy - data.current_age
+    accumulation_years = data.retirement_age - data.current_age
+    year_index = np.arange(years)
+
+    stock_weights = np.where(
+        year_index < accumulation_years,
+        data.glide_path_start + (data.glide_path_end - data.glide_path_start) * year_index / max(accumulation_years, 1),
+        data.glide_path_end
+    )
+    bond_weights = 1 - stock_weights
+    mean_returns = stock_weights * data.stock_return + bond_weights * data.bond_return
+    volatilities = np.sqrt(
+        (stock_weights * data.stock_volatility) ** 2 + (bond_weights * data.bond_volatility) ** 2
+        + 2 * stock_weights * bond_weights * data.stock_bond_correlation * data.stock_volatility * data.bond_volatility
+    )
+
+    inflation_index = (1 + data.inflation) ** (year_index + 1)
+    cash_flows = np.where(
+        year_index < accumulation_years,
+        data.annual_contribution * (1 + data.contribution_growth) ** year_index,
+        -data.annual_retirement_spending * inflation_index
+    )
+
+    paths = simulate_balance_paths(
+        data.current_balance, cash_flows, mean_returns, volatilities, years, data.simulations, data.seed
+    )
+
+    # Age at which savings run out, for the paths where they do
+    depleted = paths <= 0
+    depletion_ages = data.current_age + depleted.argmax(axis=1)[depleted.any(axis=1)] + 1
+
+    retirement_balances = paths[:, accumulation_years - 1] if accumulation_years > 0 else np.full(data.simulations, data.current_balance)
+    retirement_percentiles = np.percentile(retirement_balances, (10, 50, 90))
+    retirement_inflation = (1 + data.inflation) ** max(accumulation_years, 0)
+
+    return {
+        "probability_of_success": float((~depleted[:, -1]).mean()),
+        "balance_at_retirement": {str(p): float(v) for p, v in zip((10, 50, 90), retirement_percentiles)},
+        "real_balance_at_retirement": {str(p): float(v / retirement_inflation) for p, v in zip((10, 50, 90), retirement_percentiles)},
+        "median_depletion_age": float(np.median(depletion_ages)) if len(depletion_ages) else None,
+        "yearly_projection": [
+            {
+                "age": data.current_age + year + 1,
+                "stock_allocation": float(stock_weights[year]),
+                "cash_flow": float(cash_flows[year]),
+                **{f"p{p}": float(v) for p, v in zip((10, 50, 90), np.percentile(paths[:, year], (10, 50, 90)))}
+            }
+            for year in range(years)
+        ]
+    }
+
+
+# Simulate paying off debts month by month: interest accrues, every minimum is paid, and whatever is left
+# of the budget goes to the debt the strategy targets. Paid-off minimums roll into the next target.
+def simulate_debt_payoff(debts, monthly_budget, strategy, include_schedule=False):
+    balances = {debt.name: debt.balance for debt in debts}
+    payoff_months, schedule = {}, []
+    total_interest = total_paid = 0.0
+
+    month = 0
+    while any(balance > 0.005 for balance in balances.values()):
+        month += 1
+        if month > MAX_PAYOFF_MONTHS:
+            return None
+
+        payments = {}
+        for debt in debts:
+            if balances[debt.name] > 0.005:
+                interest = balances[debt.name] * debt.apr / 12
+                balances[debt.name] += interest
+                total_interest += interest
+                payments[debt.name] = min(debt.minimum_payment, balances[debt.name])
+
+        # Put the rest of the budget towards the targeted debts, in strategy order
+        remaining = monthly_budget - sum(payments.values())
+        order = sorted(
+            (debt for debt in debts if debt.name in payments),
+            key=lambda debt: -debt.apr if strategy == "avalanche" else balances[debt.name]
+        )
+        for debt in order:
+            extra = min(remaining, balances[debt.name] - payments[debt.name])
+            payments[debt.name] += extra
+            remaining -= extra
+
+        for name, payment in payments.items():
+            balances[name] -= payment
+            total_paid += payment
+            if balances[name] <= 0.005 and name not in payoff_months:
+                payoff_months[name] = month
+
+        if include_schedule:
+            schedule.append({
+                "month": month,
+                "payments": payments,
+                "balances": {name: max(balance, 0) for name, balance in balances.items()}
+            })
+
+    return {
+        "months_to_payoff": month,
+        "total_interest": total_interest,
+        "total_paid": total_paid,
+        "payoff_months": payoff_months,
+        "schedule": schedule if include_schedule else None
+    }
+
+# Forecast the payoff of the provided debts under each strategy
+def forecast_debt_payoff(debts, monthly_budget, strategies, start_date, include_schedule):
+    start = start_date or pd.Timestamp.today().strftime('%Y-%m-01')
+    results = {}
+    for strategy in strategies:
+        plan = simulate_debt_payoff(debts, monthly_budget, strategy, include_schedule)
+        if plan is None:
+            results[strategy] = {"months_to_payoff": None, "message": f"Debts are not paid off within {MAX_PAYOFF_MONTHS} months"}
+            continue
+
+        debt_free_by = get_dates(start, "monthly", max(plan["months_to_payoff"], 1))[-1]
+        plan["debt_free_by"] = debt_free_by.strftime('%Y-%m-%d')
+        plan["message"] = f"You'll be debt-free by {debt_free_by.strftime('%B %Y')}"
+        results[strategy] = plan
+
+    return results
+
+# Forecast next month's spend per category from transaction history and flag categories heading over budget
+def forecast_budget(transactions, budgets, method, confidence_level):
+    df = pd.DataFrame({
+        'month': parse_dates([transaction.date for transaction in transactions], "Transaction dates") + pd.offsets.MonthEnd(0),
+        'category': [transaction.category for transaction in transactions],
+        'amount': [transaction.amount for transaction in transactions]
+    })
+
+    # Total spend per category per month, with months without spend counted as zero
+    monthly = df.pivot_table(index='month', columns='category', values='amount', aggfunc='sum', fill_value=0)
+    monthly = monthly.reindex(pd.date_range(monthly.index.min(), monthly.index.max(), freq='ME'), fill_value=0)
+
+    categories = []
+    for category in monthly.columns:
+        values = monthly[category].tolist()
+        forecast = None
+        if method == "ets":
+            try:
+                forecast = forecast_holt_winters(monthly.index, values, 1, confidence_level)[0]
+            except ValueError:
+                logger.info(f"Falling back to seasonal naive forecast for {category}")
+        if forecast is None:
+            forecast = forecast_seasonal_naive(monthly.index, values, 1, confidence_level)[0]
+
+        # Compare the last three months with the three before them to report the recent trend
+        recent_trend = None
+        if len(values) >= 6:
+            recent_trend = safe_ratio(sum(values[-3:]) - sum(values[-6:-3]), sum(values[-6:-3]))
+
+        budget = budgets.get(category)
+        predicted = max(forecast['yhat'], 0)
+        categories.append({
+            "category": category,
+            "forecast": predicted,
+            "forecast_lower": max(forecast['yhat_lower'], 0),
+            "forecast_upper": max(forecast['yhat_upper'], 0),
+            "last_month": values[-1],
+            "recent_trend": recent_trend,
+            "budget": budget,
+            "over_budget": budget is not None and predicted > budget
+        })
+
+    return {
+        "month": forecast['ds'],
+        "categories": categories,
+        "over_budget_categories": [category["category"] for category in categories if category["over_budget"]]
+    }
+
+# Helper to normalize a transaction description, dropping reference numbers and punctuation
+def normalize_description(description):
+    return " ".join(re.sub(r"[^a-z ]", " ", description.lower()).split())
+
+# Naive Bayes over description words, trained on a user's corrections. Returns (category, confidence).
+def classify_with_corrections(tokens, corrections):
+    word_counts, category_counts, vocabulary = {}, {}, set()
+    for description, category in corrections.items():
+        category_counts[category] = category_counts.get(category, 0) + 1
+        counts = word_counts.setdefault(category, {})
+        for word in description.split():
+            counts[word] = counts.get(word, 0) + 1
+            vocabulary.add(word)
+
+    log_scores = {}
+    for category, count in category_counts.items():
+        total_words = sum(word_counts[category].values())
+        log_scores[category] = math.log(count / len(corrections)) + sum(
+            math.log((word_counts[category].get(word, 0) + 1) / (total_words + len(vocabulary))) for word in tokens
+        )
+
+    # Turn the log scores into probabilities to report a confidence
+    best_score = max(log_scores.values())
+    total = sum(math.exp(score - best_score) for score in log_scores.values())
+    category = max(log_scores, key=log_scores.get)
+    return category, 1 / total
+
+# Categorize a description using the user's exact corrections, then their learned model, then the keyword rules
+def categorize_description(description, corrections):
+    normalized = normalize_description(description)
+    tokens = normalized.split()
+
+    if normalized in corrections:
+        return {"description": description, "category": corrections[normalized], "confidence": 1.0, "source": "correction"}
+
+    if len(corrections) >= MIN_CORRECTIONS_FOR_MODEL and tokens:
+        category, confidence = classify_with_corrections(tokens, corrections)
+        if confidence >= MIN_MODEL_CONFIDENCE:
+            return {"description": description, "category": category, "confidence": confidence, "source": "model"}
+
+    # Pick the rule category with the most keywords found as words (or their plurals) in the description
+    matches = {
+        category: sum(1 for keyword in keywords if keyword in tokens or keyword + "s" in tokens)
+        for category, keywords in CATEGORY_RULES.items()
+    }
+    category = max(matches, key=matches.get)
+    if matches[category]:
+        return {"description": description, "category": category, "confidence": matches[category] / (matches[category] + 1), "source": "rule"}
+
+    return {"description": description, "category": "Uncategorized", "confidence": 0.0, "source": "none"}
+
+# Detect recurring income and expenses: transactions with the same description and direction that occur at a
+# regular weekly, biweekly or monthly interval. Returns the recurring items and the indexes of their transactions.
+def detect_recurring_transactions(df):
+    recurring, recurring_indexes = [], set()
+    for (key, direction), group in df.groupby(['key', 'direction']):
+        if not key or len(group) < MIN_RECURRING_OCCURRENCES:
+            continue
+
+        intervals = group['date'].sort_values().diff().dropna().dt.days
+        cadence = next(
+            (name for name, (days, tolerance) in RECURRING_CADENCES.items()
+             if (abs(intervals - days) <= tolerance).all()),
+            None
+        )
+        if cadence is None:
+            continue
+
+        recurring.append({
+            "description": key,
+            "amount": float(group['amount'].median()),
+            "cadence": cadence,
+            "occurrences": len(group),
+            "last_date": group['date'].max()
+        })
+        recurring_indexes.update(group.index)
+
+    return recurring, recurring_indexes
+
+# Helper to format a day of the month with its ordinal suffix, e.g. 28th
+def ordinal(day):
+    suffix = "th" if 11 <= day % 100 <= 13 else {1: "st", 2: "nd", 3: "rd"}.get(day % 10, "th")
+    return f"{day}{suffix}"
+
+# Forecast the daily balance from recurring items plus the average daily net flow of everything else,
+# warning about days when it is projected to drop below the threshold
+def forecast_cash_flow(transactions, current_balance, start_date, days, low_balance_threshold):
+    df = pd.DataFrame({
+        'date': parse_dates([transaction.date for transaction in transactions], "Transaction dates"),
+        'amount': [transaction.amount for transaction in transactions],
+        'key': [normalize_description(transaction.description) for transaction in transactions]
+    })
+    df['direction'] = np.sign(df['amount'])
+
+    recurring, recurring_indexes = detect_recurring_transactions(df)
+
+    start = parse_dates(start_date, "Start date") if start_date else pd.Timestamp.today().normalize()
+    flows = pd.Series(0.0, index=pd.date_range(start, periods=days, freq='D'))
+
+    # Project each recurring item forward from its last occurrence
+    for item in recurring:
+        step = pd.DateOffset(months=1) if item["cadence"] == "monthly" else pd.Timedelta(days=RECURRING_CADENCES[item["cadence"]][0])
+        next_date = item.pop("last_date") + step
+        item["next_dates"] = []
+        while next_date <= flows.index[-1]:
+            if next_date >= start:
+                flows[next_date] += item["amount"]
+                item["next_dates"].append(next_date.strftime('%Y-%m-%d'))
+            next_date += step
+
+    # Spread the remaining, non-recurring activity evenly across days
+    other = df.drop(index=list(recurring_indexes))
+    history_days = (df['date'].max() - df['date'].min()).days + 1
+    daily_discretionary = other['amount'].sum() / history_days
+    flows += daily_discretionary
+
+    balances = current_balance + flows.cumsum()
+    low_days = balances[balances < low_balance_threshold]
+
+    warnings = []
+    if not low_days.empty:
+        first_low = low_days.index[0]
+        warnings.append({
+            "date": first_low.strftime('%Y-%m-%d'),
+            "projected_balance": float(low_days.iloc[0]),
+            "message": f"Projected low balance on the {ordinal(first_low.day)}"
+        })
+
+    return {
+        "recurring": recurring,
+        "daily_discretionary": float(daily_discretionary),
+        "projection": [{"ds": date.strftime('%Y-%m-%d'), "balance": float(balance)} for date, balance in balances.items()],
+        "lowest_balance": {"ds": balances.idxmin().strftime('%Y-%m-%d'), "balance": float(balances.min())},
+        "low_balance_warnings": warnings
+    }
+
+# Helper to apply a scenario operation to a single value
+def apply_scenario_operation(current, operation, value):
+    if operation == "set":
+        return value
+    if operation == "add":
+        return current + value
+    if operation == "multiply":
+        return current * value
+    raise InputError("unsupported_scenario_operation", f"Unsupported scenario operation: {operation}")
+
+# Apply a scenario's changes to a copy of a baseline request body
+def apply_scenario_changes(baseline, changes):
+    request = copy.deepcopy(baseline)
+    for change in changes:
+        field, _, item_field = change.field.partition(".")
+        if change.operation == "remove":
+            request[field] = [
+                item for item in request.get(field, []) if change.value not in (item.get("symbol"), item.get("name"))
+            ]
+        elif item_field:
+            for item in request.get(field, []):
+                item[item_field] = apply_scenario_operation(item.get(item_field), change.operation, change.value)
+        else:
+            request[field] = apply_scenario_operation(request.get(field), change.operation, change.value)
+    return request
+
+# Difference between the numeric values of a scenario result and the baseline result, following nested objects
+def diff_numeric_results(baseline, scenario):
+    differences = {}
+    for key, value in scenario.items():
+        base_value = baseline.get(key) if isinstance(baseline, dict) else None
+        if isinstance(value, dict) and isinstance(base_value, dict):
+            nested = diff_numeric_results(base_value, value)
+            if nested:
+                differences[key] = nested
+        elif isinstance(value, (int, float)) and isinstance(base_value, (int, float)) and not isinstance(value, bool):
+            differences[key] = value - base_value
+    return differences
+
+
+# Helper to parse a request date, or a list of them, raising an input error naming the field if it can't be read
+def parse_dates(value, field):
+    try:
+        parsed = pd.to_datetime(value)
+    except (ValueError, TypeError, OverflowError):
+        parsed = None
+    # Missing and empty dates parse to None and NaT
+    if parsed is None or parsed is pd.NaT:
+        raise InputError("invalid_date", f"{field} must be in YYYY-MM-DD or ISO 8601 format")
+    return parsed
+
+# Helper to process the dates for input data
+def get_dates(start_date, frequency, length):
+    start = parse_dates(start_date, "Start date")
+    if frequency == "monthly":
+        return pd.date_range(start=start, periods=length, freq='ME')
+    elif frequency == "weekly":
+        return pd.date_range(start=start, periods=length, freq='W')
+    elif frequency == "daily":
+        return pd.date_range(start=start, periods=length, freq='D')
+    else:
+        logger.error("Unsupported frequency")
+        raise InputError("unsupported_frequency", "Unsupported frequency")
+
+
+# Helper to validate the requested forecasting model
+def validate_model(model_name):
+    if model_name not in SUPPORTED_MODELS:
+        logger.error("Unsupported model")
+        raise InputError("unsupported_model", "Unsupported model")
+
+# Helper to look up a registered model version, falling back to the model's active version
+def resolve_model_version(model_name, model_version=None):
+    validate_model(model_name)
+    version = model_version or active_model_versions[model_name]
+    if version not in model_versions[model_name]:
+        logger.error("Unknown model version")
+        raise InputError("model_version_not_found", f"Unknown version {version} for model {model_name}", 404)
+    return model_versions[model_name][version]
+
+# Helper to serve a drifted model version's requests with its fallback model's active version, if it has one
+def apply_drift_fallback(model_info):
+    if model_info.get("drift") and model_info.get("fallback_model"):
+        logger.info(f"Falling back from drifted {model_info['name']} version {model_info['version']}")
+        return resolve_model_version(model_info["fallback_model"])
+    return model_info
+
+# Compare a model version's error over its latest predictions scored by services with its backtest baseline,
+# flagging the version as drifted (or clearing the flag) accordingly. Scores posted by users never count, since
+# the flag reroutes every user's requests.
+def check_model_drift(model_name, version):
+    model_info = model_versions.get(model_name, {}).get(version)
+    if model_info is None or not model_info.get("backtest_baseline"):
+        return
+    baseline_mape = model_info["backtest_baseline"]["mape"]
+    if baseline_mape is None:
+        return
+
+    evaluations = [
+        prediction["evaluation"]["metrics"]["mape"] for prediction in prediction_store.values()
+        if prediction["model"] == model_name and prediction["model_version"] == version
+        and "evaluation" in prediction and prediction["evaluation"]["source"] == "service"
+        and prediction["evaluation"]["metrics"]["mape"] is not None
+    ][-DRIFT_WINDOW:]
+    if len(evaluations) < DRIFT_MIN_PREDICTIONS:
+        return
+
+    rolling_mape = float(np.mean(evaluations))
+    if rolling_mape > baseline_mape * DRIFT_THRESHOLD:
+        if not model_info.get("drift"):
+            logger.error(
+                f"Model drift detected for {model_name} version {version}: "
+                f"rolling MAPE {rolling_mape:.2f} against backtest MAPE {baseline_mape:.2f}"
+            )
+        model_info["drift"] = {
+            "rolling_mape": rolling_mape,
+            "baseline_mape": baseline_mape,
+            "predictions": len(evaluations),
+            "detected_at": model_info.get("drift", {}).get("detected_at") or datetime.now(timezone.utc).isoformat()
+        }
+    else:
+        model_info.pop("drift", None)
+
+# Helper to validate the requested confidence level for prediction intervals
+def validate_confidence_level(confidence_level):
+    if not 0 < confidence_level < 1:
+        logger.error("Unsupported confidence level")
+        raise InputError("invalid_confidence_level", "Confidence level must be between 0 and 1")
+
+# Helper to validate a list of confidence levels
+def validate_confidence_levels(confidence_levels):
+    if not confidence_levels:
+        raise InputError("invalid_confidence_level", "At least one confidence level is required")
+    for confidence_level in confidence_levels:
+        validate_confidence_level(confidence_level)
+
+# Helper to keep an issued prediction available for retrieval
+def store_prediction(prediction):
+    if len(prediction_store) >= MAX_STORED_PREDICTIONS:
+        evicted = next(iter(prediction_store))
+        prediction_store.pop(evicted)
+        shadow_predictions.pop(evicted, None)
+    prediction_store[prediction["id"]] = prediction
+
+# Forecast a series request with a shadow model version, storing the forecast against the served prediction.
+# Failures are only logged, since shadow forecasts never affect the served prediction.
+async def run_shadow_prediction(data, prediction, model_info, dates, values, enable_holidays):
+    try:
+        sentiment = None
+        if model_info.get("use_sentiment"):
+            if not data.sentiment or len(data.sentiment) < len(data.values):
+                return
+            sentiment = data.sentiment[:len(data.values) + prediction["horizon"]]
+
+        forecast = await asyncio.to_thread(
+            cached_forecast_data, dates, values, data.country, prediction["horizon"],
+            data.enable_seasonality, enable_holidays, model_name=model_info["name"],
+            confidence_level=data.confidence_level, sentiment=sentiment, hyperparameters=model_info["hyperparameters"]
+        )
+        if prediction["id"] in prediction_store:
+            shadow_predictions[prediction["id"]] = {
+                "model": model_info["name"],
+                "model_version": model_info["version"],
+                "predictions": forecast
+            }
+    except Exception as e:
+        logger.error(f"Shadow prediction with {model_info['name']} version {model_info['version']} failed: {str(e)}")
+
+# Helper to score forecast points against realized values matched by date, or None if no dates match
+def evaluate_forecast(forecast, actuals, last_value):
+    points = [
+        {"ds": point["ds"], "actual": actuals[point["ds"]], "predicted": point["yhat"]}
+        for point in forecast if point["ds"] in actuals
+    ]
+    if not points:
+        return None
+    return {
+        "points": points,
+        "metrics": compute_error_metrics(
+            [point["actual"] for point in points],
+            [point["predicted"] for point in points],
+            [last_value] * len(points)
+        )
+    }
+
+
+# Main prediction function using asyncio for parallelism
+async def process_predictions(data: PredictionRequest):
+    try:
+        model_info = apply_drift_fallback(resolve_model_version(data.model, data.model_version))
+        validate_confidence_level(data.confidence_level)
+
+        tasks = []
+
+        # Add expense prediction task if expenses data is provided
+        if data.expenses:
+            dates = get_dates(data.expenses_start_date or data.start_date, data.frequency, len(data.expenses))
+            expenses = remove_anomalies(data.expenses) if data.exclude_anomalies else data.expenses
+            tasks.append(asyncio.to_thread(
+                cached_forecast_data, dates, expenses, data.country, data.prediction_period, 
+                data.enable_seasonality, data.enable_holidays, data.tax_deductions, data.tax_rate, model_info["name"],
+                data.include_components, data.confidence_level, data.include_explanations,
+                hyperparameters=model_info["hyperparameters"]
+            ))
+
+        # Add income prediction task if incomes data is provided
+        if data.incomes:
+            dates = get_dates(data.incomes_start_date or data.start_date, data.frequency, len(data.incomes))
+            incomes = remove_anomalies(data.incomes) if data.exclude_anomalies else data.incomes
+            tasks.append(asyncio.to_thread(
+                cached_forecast_data, dates, incomes, data.country, data.prediction_period, 
+                data.enable_seasonality, data.enable_holidays, data.tax_deductions, data.tax_rate, model_info["name"],
+                data.include_components, data.confidence_level, data.include_explanations,
+                hyperparameters=model_info["hyperparameters"]
+            ))
+
+        # Add savings prediction task if savings data is provided
+        if data.savings:
+            dates = get_dates(data.savings_start_date or data.start_date, data.frequency, data.prediction_period)
+            tasks.append(asyncio.to_thread(
+                forecast_savings, data.savings, data.savings_start_date or data.start_date, data.prediction_period, 
+                data.country, data.enable_seasonality, data.enable_holidays, data.confidence_level
+            ))
+
+        # Run all the tasks concurrently and gather results
+        results = await asyncio.gather(*tasks)
+
+        # Initialize the result dictionary
+        result_dict = {
+            "expense_predictions": None,
+            "income_predictions": None,
+            "savings_predictions": None
+        }
+
+        result_index = 0
         if data.expenses:
             result_dict["expense_predictions"] = results[result_index]
             result_index += 1
@@ -184,27 +2536,1506 @@ async def process_predictions(data: PredictionRequest):
 
         return result_dict
 
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Forecast a single series and record the result so it can be fetched again by ID
+async def process_series_prediction(data: SeriesPredictionRequest):
+    try:
+        model_info = apply_drift_fallback(resolve_model_version(data.model, data.model_version))
+        validate_confidence_level(data.confidence_level)
+
+        if data.asset_class not in ASSET_CLASSES:
+            raise InputError("unsupported_asset_class", f"Unsupported asset class, expected one of: {', '.join(ASSET_CLASSES)}")
+
+        # Crypto has no market calendar, so no holidays, and its own default horizons
+        is_crypto = data.asset_class == "crypto"
+        enable_holidays = data.enable_holidays and not is_crypto
+        # The crypto default horizons only apply when the caller asked for no horizon at all
+        horizons = data.horizons
+        if is_crypto and data.horizon is None and not horizons:
+            horizons = CRYPTO_DEFAULT_HORIZONS.get(data.frequency)
+
+        # Forecast once up to the furthest requested horizon
+        horizon = data.horizon if data.horizon is not None else DEFAULT_SERIES_HORIZON
+        if horizons:
+            if min(horizons) < 1:
+                raise InputError("invalid_horizon", "Horizons must be at least 1 period")
+            horizon = max(horizons)
+        if horizon < 1:
+            raise InputError("invalid_horizon", "Horizon must be at least 1 period")
+        if horizon > MAX_FORECAST_HORIZON:
+            raise InputError("invalid_horizon", f"Horizons must be at most {MAX_FORECAST_HORIZON} periods")
+
+        # Sentiment is only used by model versions configured for it, and must cover the whole history
+        sentiment = None
+        if model_info.get("use_sentiment"):
+            if not data.sentiment or len(data.sentiment) < len(data.values):
+                raise InputError("sentiment_required", "This model version requires a sentiment score for every value")
+            sentiment = data.sentiment[:len(data.values) + horizon]
+
+        dates = get_dates(data.start_date, data.frequency, len(data.values))
+        values = remove_anomalies(data.values) if data.exclude_anomalies else data.values
+        forecast = await asyncio.to_thread(
+            cached_forecast_data, dates, values, data.country, horizon,
+            data.enable_seasonality, enable_holidays, model_name=model_info["name"],
+            confidence_level=data.confidence_level, include_explanations=data.include_explanations,
+            sentiment=sentiment, hyperparameters=model_info["hyperparameters"]
+        )
+
+        prediction = {
+            "id": str(uuid.uuid4()),
+            "inputs_hash": get_cache_key(data.dict()),
+            "user_id": current_user_id.get(),
+            "symbol": data.symbol,
+            "asset_class": data.asset_class,
+            "model": model_info["name"],
+            "model_version": model_info["version"],
+            "uses_sentiment": sentiment is not None,
+            "horizon": horizon,
+            "confidence_level": data.confidence_level,
+            "created_at": datetime.now(timezone.utc).isoformat(),
+            "last_value": data.values[-1],
+            "predictions": forecast
+        }
+
+        # Pick out the forecast point, with its interval, at each requested horizon
+        if horizons:
+            prediction["horizon_predictions"] = [
+                {"horizon": h, **forecast[h - 1]} for h in sorted(set(horizons))
+            ]
+
+        store_prediction(prediction)
+
+        # Forecast the same request with the model's shadow version in the background, unless a version was pinned
+        shadow_version = shadow_model_versions.get(data.model)
+        if shadow_version and not data.model_version and shadow_version != model_info["version"]:
+            shadow_run = asyncio.create_task(run_shadow_prediction(
+                data, prediction, model_versions[data.model][shadow_version], dates, values, enable_holidays
+            ))
+            shadow_runs.add(shadow_run)
+            shadow_run.add_done_callback(shadow_runs.discard)
+
+        return prediction
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Forecast every series in a batch with bounded parallelism, reporting failures per series
+async def process_batch_predictions(data: BatchPredictionRequest):
+    if len(data.predictions) > MAX_BATCH_PREDICTIONS:
+        raise ApiError(400, "too_many_predictions", detail=f"At most {MAX_BATCH_PREDICTIONS} series can be forecast in one batch")
+    semaphore = asyncio.Semaphore(MAX_BATCH_CONCURRENCY)
+
+    async def predict(item: SeriesPredictionRequest):
+        async with semaphore:
+            try:
+                return await process_series_prediction(item)
+            except HTTPException as e:
+                return {"symbol": item.symbol, "error": e.detail, "error_code": problem_code(e)}
+            except Exception as e:
+                logger.error(f"Batch prediction for {item.symbol} failed: {str(e)}")
+                return {"symbol": item.symbol, "error": "Internal server error", "error_code": "internal_error"}
+
+    results = await asyncio.gather(*(predict(item) for item in data.predictions))
+    return {"predictions": results}
+
+# Helper to validate simulation settings shared by the Monte Carlo endpoints
+def validate_simulation_settings(horizons, simulations, percentiles, assets=1):
+    if not horizons or min(horizons) < 1:
+        raise InputError("invalid_horizon", "Horizons must be at least 1 period")
+    if max(horizons) > MAX_SIMULATION_PERIODS:
+        raise InputError("invalid_horizon", f"Horizons must be at most {MAX_SIMULATION_PERIODS} periods")
+    if not 1 <= simulations <= MAX_SIMULATIONS:
+        raise InputError("invalid_simulations", f"Simulations must be between 1 and {MAX_SIMULATIONS}")
+    if simulations * max(horizons) * assets > MAX_SIMULATED_VALUES:
+        raise InputError("simulation_too_large", f"Simulations x periods x assets must be at most {MAX_SIMULATED_VALUES}, reduce the simulations or horizon")
+    if any(not 0 <= percentile <= 100 for percentile in percentiles):
+        raise InputError("invalid_percentiles", "Percentiles must be between 0 and 100")
+
+# Helper to look up the calibration profile of the request's user, if any
+def get_calibration(data):
+    return user_calibration_profiles.get(data.user_id) if data.user_id else None
+
+# Helper to apply a calibration profile to a projection request's return and volatility assumptions
+def calibrate_request(data, calibration, return_fields, volatility_fields):
+    if calibration is None:
+        return data
+    updates = {field: getattr(data, field) + calibration["return_adjustment"] for field in return_fields}
+    updates.update({field: getattr(data, field) * calibration["volatility_multiplier"] for field in volatility_fields})
+    return data.copy(update=updates)
+
+# Run a Monte Carlo projection of the provided portfolio
+async def process_portfolio_projection(data: PortfolioProjectionRequest):
+    try:
+        if not data.positions:
+            raise InputError("positions_required", "At least one position is required")
+        if data.periods_per_year < 1:
+            raise InputError("invalid_periods_per_year", "Periods per year must be at least 1")
+        validate_simulation_settings(data.horizons, data.simulations, data.percentiles, len(data.positions))
+
+        # Calibration adjusts annual returns, so spread the adjustment over the periods of the price histories
+        calibration = get_calibration(data)
+        return_adjustment = calibration["return_adjustment"] / data.periods_per_year if calibration else 0.0
+        volatility_multiplier = calibration["volatility_multiplier"] if calibration else 1.0
+
+        result = await asyncio.to_thread(
+            project_portfolio, data.positions, data.horizons, data.simulations, data.percentiles, data.seed,
+            return_adjustment, volatility_multiplier
+        )
+        if calibration:
+            result["calibration"] = calibration
+        return result
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Compute Value-at-Risk and CVaR for the provided portfolio
+async def process_risk(data: RiskRequest):
+    try:
+        if not data.positions:
+            raise InputError("positions_required", "At least one position is required")
+        if data.horizon < 1:
+            raise InputError("invalid_horizon", "Horizon must be at least 1 period")
+        validate_confidence_levels(data.confidence_levels)
+        if data.volatility_model not in VOLATILITY_MODELS:
+            raise InputError("unsupported_volatility_model", f"Unsupported volatility model, expected one of: {', '.join(VOLATILITY_MODELS)}")
+
+        return await asyncio.to_thread(
+            compute_value_at_risk, data.positions, data.confidence_levels, data.horizon, data.volatility_model
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Forecast forward volatility for the provided assets
+async def process_volatility(data: VolatilityRequest):
+    try:
+        if not data.assets:
+            raise InputError("assets_required", "At least one asset is required")
+        if data.horizon < 1:
+            raise InputError("invalid_horizon", "Horizon must be at least 1 period")
+        if data.horizon > MAX_FORECAST_HORIZON:
+            raise InputError("invalid_horizon", f"Horizon must be at most {MAX_FORECAST_HORIZON} periods")
+        if data.asset_class not in ASSET_CLASSES:
+            raise InputError("unsupported_asset_class", f"Unsupported asset class, expected one of: {', '.join(ASSET_CLASSES)}")
+        periods_per_year = data.periods_per_year or TRADING_DAYS_PER_YEAR[data.asset_class]
+        if periods_per_year < 1:
+            raise InputError("invalid_periods_per_year", "Periods per year must be at least 1")
+        if data.elevated_threshold <= 0:
+            raise InputError("invalid_elevated_threshold", "Elevated threshold must be positive")
+        validate_confidence_level(data.confidence_level)
+
+        return await asyncio.to_thread(
+            forecast_volatility, data.assets, data.horizon, periods_per_year, data.confidence_level,
+            data.elevated_threshold
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Compute risk-adjusted performance metrics for the provided portfolio
+async def process_performance_metrics(data: PerformanceMetricsRequest):
+    try:
+        if not data.positions:
+            raise InputError("positions_required", "At least one position is required")
+        if data.periods_per_year < 1:
+            raise InputError("invalid_periods_per_year", "Periods per year must be at least 1")
+
+        return await asyncio.to_thread(
+            compute_portfolio_metrics, data.positions, data.benchmark_prices, data.risk_free_rate, data.periods_per_year
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Optimize the allocation across the provided assets
+async def process_portfolio_optimization(data: PortfolioOptimizationRequest):
+    try:
+        if len(data.assets) < 2:
+            raise InputError("assets_required", "At least two assets are required")
+        if data.objective not in OPTIMIZATION_OBJECTIVES:
+            raise InputError("unsupported_objective", "Unsupported objective")
+        if data.objective == "target_return" and data.target_return is None:
+            raise InputError("target_return_required", "A target return is required for the target_return objective")
+        if not data.min_weight * len(data.assets) <= 1 <= data.max_weight * len(data.assets):
+            raise InputError("invalid_weight_bounds", "Weight bounds cannot be met with weights summing to 1")
+        if data.periods_per_year < 1 or data.frontier_points < 0:
+            raise InputError("invalid_optimization_settings", "Periods per year must be at least 1 and frontier points cannot be negative")
+
+        return await asyncio.to_thread(
+            optimize_portfolio, data.assets, data.objective, data.target_return, data.risk_free_rate,
+            data.periods_per_year, (data.min_weight, data.max_weight), data.frontier_points
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Build a rebalancing plan for the provided holdings
+async def process_rebalance(data: RebalanceRequest):
+    try:
+        if not data.holdings and not data.cash:
+            raise InputError("holdings_required", "Holdings or cash are required")
+        if any(weight < 0 for weight in data.target_weights.values()):
+            raise InputError("invalid_target_weights", "Target weights cannot be negative")
+        if abs(sum(data.target_weights.values()) - 1) > 1e-4:
+            raise InputError("invalid_target_weights", "Target weights must sum to 1")
+        if sum(holding.value for holding in data.holdings) + data.cash <= 0:
+            raise InputError("invalid_portfolio_value", "Portfolio value must be positive")
+
+        return compute_rebalance_plan(
+            data.holdings, data.target_weights, data.cash, data.drift_threshold,
+            data.transaction_cost_rate, data.fixed_cost_per_trade
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Compute correlations for the provided assets, reusing cached results for the same assets and settings
+async def process_correlations(data: CorrelationRequest):
+    try:
+        symbols = [asset.symbol for asset in data.assets]
+        if len(symbols) < 2 or len(set(symbols)) != len(symbols):
+            raise InputError("assets_required", "At least two distinct assets are required")
+        if data.lookbacks and min(data.lookbacks) < 2:
+            raise InputError("invalid_lookback", "Lookbacks must be at least 2 periods")
+
+        price_histories = [asset.prices for asset in data.assets]
+        key = get_cache_key(symbols, price_histories, data.lookbacks, data.weights)
+
+        result = get_cached_result(correlation_cache, key)
+        if result is None:
+            result = await asyncio.to_thread(compute_correlations, symbols, price_histories, data.lookbacks, data.weights)
+            store_cached_result(correlation_cache, key, result, MAX_CACHED_CORRELATIONS)
+
+        return result
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Project whether the provided savings goal will be met
+async def process_goal_projection(data: GoalProjectionRequest):
+    try:
+        if data.goal <= 0:
+            raise InputError("invalid_goal", "Goal must be positive")
+        validate_simulation_settings([data.months], data.simulations, [])
+
+        calibration = get_calibration(data)
+        data = calibrate_request(data, calibration, ["expected_annual_return"], ["annual_volatility"])
+
+        result = await asyncio.to_thread(
+            project_goal, data.current_balance, data.monthly_contribution, data.goal, data.months,
+            data.expected_annual_return, data.annual_volatility, data.simulations, data.milestones, data.seed
+        )
+        if calibration:
+            result["calibration"] = calibration
+        return result
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Project retirement readiness for the provided plan
+async def process_retirement_projection(data: RetirementProjectionRequest):
+    try:
+        if not data.current_age <= data.retirement_age < data.life_expectancy:
+            raise InputError("invalid_ages", "Ages must satisfy current age <= retirement age < life expectancy")
+        if not (0 <= data.glide_path_start <= 1 and 0 <= data.glide_path_end <= 1):
+            raise InputError("invalid_glide_path", "Glide path allocations must be between 0 and 1")
+        validate_simulation_settings([data.life_expectancy - data.current_age], data.simulations, [])
+
+        calibration = get_calibration(data)
+        data = calibrate_request(
+            data, calibration, ["stock_return", "bond_return"], ["stock_volatility", "bond_volatility"]
+        )
+
+        result = await asyncio.to_thread(project_retirement, data)
+        if calibration:
+            result["calibration"] = calibration
+        return result
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Forecast payoff schedules for the provided debts
+async def process_debt_payoff(data: DebtPayoffRequest):
+    try:
+        if not data.debts:
+            raise InputError("debts_required", "At least one debt is required")
+        if len({debt.name for debt in data.debts}) != len(data.debts):
+            raise InputError("duplicate_debt_name", "Debt names must be unique")
+        if any(strategy not in DEBT_STRATEGIES for strategy in data.strategies):
+            raise InputError("unsupported_strategy", "Unsupported strategy")
+        if data.monthly_budget < sum(debt.minimum_payment for debt in data.debts):
+            raise InputError("insufficient_budget", "Monthly budget must cover every minimum payment", 422)
+
+        return await asyncio.to_thread(
+            forecast_debt_payoff, data.debts, data.monthly_budget, data.strategies, data.start_date, data.include_schedule
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Forecast next month's spend per category for the provided transactions
+async def process_budget_forecast(data: BudgetForecastRequest):
+    try:
+        if not data.transactions:
+            raise InputError("transactions_required", "At least one transaction is required")
+        if data.method not in BUDGET_METHODS:
+            raise InputError("unsupported_method", "Unsupported method")
+        validate_confidence_level(data.confidence_level)
+
+        return await asyncio.to_thread(
+            forecast_budget, data.transactions, data.budgets, data.method, data.confidence_level
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Forecast near-term cash flow for the provided transaction history
+async def process_cash_flow_forecast(data: CashFlowRequest):
+    try:
+        if not data.transactions:
+            raise InputError("transactions_required", "At least one transaction is required")
+        if not 1 <= data.days <= 366:
+            raise InputError("invalid_days", "Days must be between 1 and 366")
+
+        return await asyncio.to_thread(
+            forecast_cash_flow, data.transactions, data.current_balance, data.start_date, data.days, data.low_balance_threshold
+        )
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Projections that can be run as what-if scenarios, with their request model and processing function
+SCENARIO_PROJECTIONS = {
+    "goal": (GoalProjectionRequest, process_goal_projection),
+    "retirement": (RetirementProjectionRequest, process_retirement_projection),
+    "debt_payoff": (DebtPayoffRequest, process_debt_payoff),
+    "portfolio": (PortfolioProjectionRequest, process_portfolio_projection),
+}
+
+# Helper to count the values a projection request simulates, as limited by validate_simulation_settings
+def count_simulated_values(projection, request):
+    if projection == "goal":
+        periods, assets = request.months, 1
+    elif projection == "retirement":
+        periods, assets = request.life_expectancy - request.current_age, 1
+    elif projection == "portfolio":
+        periods, assets = max(request.horizons, default=0), len(request.positions)
+    else:
+        return 0
+    return max(request.simulations * periods * assets, 0)
+
+# Run the baseline projection and each what-if scenario, comparing every scenario with the baseline
+async def process_scenarios(data: ScenarioRequest):
+    if data.projection not in SCENARIO_PROJECTIONS:
+        raise ApiError(400, "unsupported_projection", detail="Unsupported projection")
+    if len(data.scenarios) > MAX_SCENARIOS:
+        raise ApiError(400, "too_many_scenarios", detail=f"At most {MAX_SCENARIOS} scenarios can be compared at once")
+    request_model, process = SCENARIO_PROJECTIONS[data.projection]
+
+    # Simulated projections share a seed so differences come from the changes rather than sampling noise
+    baseline = authorize_payload(request_model, dict(data.baseline))
+    if "seed" in request_model.__fields__ and baseline.get("seed") is None:
+        baseline["seed"] = random.randrange(2 ** 32)
+
+    try:
+        baseline_request = request_model(**baseline)
+        scenario_requests = {}
+        for name, changes in data.scenarios.items():
+            scenario = apply_scenario_changes(baseline, changes)
+            # Every scenario runs as the baseline's user
+            if "user_id" in baseline:
+                scenario["user_id"] = baseline["user_id"]
+            scenario_requests[name] = request_model(**scenario)
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
     except Exception as e:
-        logger.error(f"Prediction processing failed: {str(e)}")
-        raise HTTPException(status_code=500, detail=str(e))
+        # The baseline or a scenario doesn't make a valid request for the projection
+        raise ApiError(422, "invalid_scenario", detail=str(e))
+
+    requests = [baseline_request, *scenario_requests.values()]
+    if sum(count_simulated_values(data.projection, request) for request in requests) > MAX_SIMULATED_VALUES:
+        raise ApiError(
+            400, "simulation_too_large",
+            detail=f"Simulated values across the baseline and scenarios must be at most {MAX_SIMULATED_VALUES}"
+        )
+
+    # Run the projections one at a time, so a request holds at most one simulation in memory
+    baseline_result = await process(baseline_request)
+    scenario_results = []
+    for request in scenario_requests.values():
+        scenario_results.append(await process(request))
+
+    return {
+        "projection": data.projection,
+        "baseline": baseline_result,
+        "scenarios": {
+            name: {
+                "changes": data.scenarios[name],
+                "result": result,
+                "difference": diff_numeric_results(baseline_result, result)
+            }
+            for name, result in zip(scenario_requests, scenario_results)
+        }
+    }
+
+# Export an aligned feature/target dataset for the provided series
+async def process_dataset_export(data: DatasetExportRequest):
+    try:
+        if not data.series:
+            raise InputError("series_required", "At least one series is required")
+        if data.format not in DATASET_FORMATS:
+            raise InputError("unsupported_format", f"Unsupported format, expected one of: {', '.join(DATASET_FORMATS)}")
+        if not data.lags or min(data.lags) < 1:
+            raise InputError("invalid_lags", "Lags must be at least 1 period")
+        if data.window < 2 or data.target_horizon < 1:
+            raise InputError("invalid_window", "Window must be at least 2 periods and target horizon at least 1 period")
+
+        dataset = await asyncio.to_thread(
+            build_training_dataset, data.series, data.frequency, sorted(set(data.lags)), data.window,
+            data.target_horizon, data.from_date, data.to_date
+        )
+
+        if data.format == "csv":
+            return Response(
+                content=dataset.to_csv(index=False),
+                media_type="text/csv",
+                headers={"Content-Disposition": 'attachment; filename="training_dataset.csv"'}
+            )
+        return {"rows": len(dataset), "columns": list(dataset.columns), "dataset": to_json_records(dataset)}
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Flag anomalous values in the provided series
+async def process_anomalies(data: AnomalyRequest):
+    try:
+        dates = get_dates(data.start_date, data.frequency, len(data.values)) if data.start_date else None
+        anomalies = [
+            {
+                "index": index,
+                "ds": dates[index].strftime('%Y-%m-%d') if dates is not None else None,
+                "value": data.values[index],
+                "z_score": z_score
+            }
+            for index, z_score in detect_anomalies(data.values, data.threshold)
+        ]
+        return {"anomalies": anomalies}
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Compute technical indicators for the provided price series
+async def process_indicators(data: IndicatorRequest):
+    try:
+        has_high_low = data.high is not None and data.low is not None
+        indicators = data.indicators or [
+            indicator for indicator in SUPPORTED_INDICATORS if has_high_low or indicator not in HIGH_LOW_INDICATORS
+        ]
+
+        unsupported = set(indicators) - set(SUPPORTED_INDICATORS)
+        if unsupported:
+            raise InputError("unsupported_indicator", f"Unsupported indicators: {', '.join(sorted(unsupported))}")
+        if not has_high_low and set(indicators) & set(HIGH_LOW_INDICATORS):
+            raise InputError("high_low_required", "High and low prices are required for ATR and the stochastic oscillator")
+        if has_high_low and not len(data.high) == len(data.low) == len(data.close):
+            raise InputError("price_length_mismatch", "High, low and close prices must have the same length")
+        if data.window < 1 or data.period < 1:
+            raise InputError("invalid_window", "Window and period must be at least 1 period")
+        if data.num_std <= 0:
+            raise InputError("invalid_num_std", "Bollinger Band width must be a positive number of standard deviations")
+
+        result = compute_indicators(data.close, data.high, data.low, indicators, data.window, data.period, data.num_std)
+
+        # Label each row with its date if a start date was provided
+        if data.start_date:
+            dates = get_dates(data.start_date, data.frequency, len(data.close))
+            result.insert(0, 'ds', dates.strftime('%Y-%m-%d'))
+
+        return {"indicators": to_json_records(result)}
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Run a walk-forward backtest of the requested model over the provided series
+async def process_backtest(data: BacktestRequest):
+    try:
+        model_info = resolve_model_version(data.model, data.model_version)
+
+        if data.initial_window < 2 or data.horizon < 1:
+            raise InputError("invalid_window", "Initial window must be at least 2 periods and horizon at least 1 period")
+        if len(data.values) < data.initial_window + data.horizon:
+            raise InputError("insufficient_history", "Not enough values for the requested initial window and horizon", 422)
+
+        dates = get_dates(data.start_date, data.frequency, len(data.values))
+        result = await asyncio.to_thread(
+            run_backtest, dates, data.values, data.model, data.initial_window, data.horizon,
+            data.country, data.enable_seasonality, data.enable_holidays, model_info["hyperparameters"]
+        )
+
+        # The latest backtest is the baseline the version's live accuracy is compared with for drift
+        model_info["backtest_baseline"] = {**result["metrics"], "recorded_at": datetime.now(timezone.utc).isoformat()}
+        model_info.pop("drift", None)
+
+        return {"model": data.model, "model_version": model_info["version"], "horizon": data.horizon, **result}
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+
+# Tune ensemble weights from member backtests and register them as a new ensemble version
+async def process_ensemble_tuning(data: EnsembleTuningRequest):
+    try:
+        if data.version in model_versions[ENSEMBLE_MODEL]:
+            raise InputError("model_version_exists", "Ensemble version already registered", 409)
+        normalize_ensemble_weights({member: 1 for member in data.members})
+        if data.initial_window < 2 or data.horizon < 1:
+            raise InputError("invalid_window", "Initial window must be at least 2 periods and horizon at least 1 period")
+        if len(data.values) < data.initial_window + data.horizon:
+            raise InputError("insufficient_history", "Not enough values for the requested initial window and horizon", 422)
+
+        dates = get_dates(data.start_date, data.frequency, len(data.values))
+        weights, metrics = await asyncio.to_thread(
+            tune_ensemble_weights, dates, data.values, data.members, data.initial_window, data.horizon,
+            data.country, data.enable_seasonality, data.enable_holidays
+        )
+
+        model_info = {
+            "name": ENSEMBLE_MODEL,
+            "version": data.version,
+            "asset_classes": [],
+            "hyperparameters": {"weights": weights},
+            "artifact_location": None,
+            "use_sentiment": False,
+            "fallback_model": None,
+            "registered_at": datetime.now(timezone.utc).isoformat()
+        }
+        model_versions[ENSEMBLE_MODEL][data.version] = model_info
+        if data.activate:
+            active_model_versions[ENSEMBLE_MODEL] = data.version
+        logger.info(f"Registered tuned ensemble version {data.version}")
+
+        return {**model_info, "active": active_model_versions[ENSEMBLE_MODEL] == data.version, "member_metrics": metrics}
+
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+# Job types that run admin computations, which need an API key with the admin scope like their endpoints
+ADMIN_JOB_TYPES = ("backtest", "ensemble_tuning")
+
+# Computations that can be run as background jobs, with their request model and processing function
+JOB_TYPES = {
+    "backtest": (BacktestRequest, process_backtest),
+    "ensemble_tuning": (EnsembleTuningRequest, process_ensemble_tuning),
+    "portfolio_projection": (PortfolioProjectionRequest, process_portfolio_projection),
+    "portfolio_optimization": (PortfolioOptimizationRequest, process_portfolio_optimization),
+    "goal_projection": (GoalProjectionRequest, process_goal_projection),
+    "retirement_projection": (RetirementProjectionRequest, process_retirement_projection),
+    "scenarios": (ScenarioRequest, process_scenarios),
+}
+
+# Helper to keep a submitted job available for status polling. Queued and running jobs are never evicted, so
+# submissions are rejected while every stored job is unfinished.
+def store_job(job):
+    if len(job_store) >= MAX_STORED_JOBS:
+        finished = (job_id for job_id, stored in job_store.items() if stored["status"] in ("completed", "failed"))
+        evicted = next(finished, None)
+        if evicted is None:
+            raise ApiError(
+                503, "job_queue_full", detail="Too many unfinished jobs, try again later", headers={"Retry-After": "60"}
+            )
+        job_store.pop(evicted)
+        job_events.pop(evicted, None)
+    job_store[job["id"]] = job
+    job_events[job["id"]] = asyncio.Event()
 
+# Worker that runs queued jobs one at a time, recording each job's result or error
+async def run_job_worker():
+    while True:
+        job_id, request = await job_queue.get()
+        job = job_store.get(job_id)
+        if job is not None:
+            # Run the job as the user who submitted it, under the submitting request's ID
+            current_user_id.set(job.get("user_id"))
+            current_api_key.set(job.get("api_key"))
+            current_request_id.set(job.get("request_id"))
+            job["status"] = "running"
+            job["started_at"] = datetime.now(timezone.utc).isoformat()
+            try:
+                job["result"] = await JOB_TYPES[job["type"]][1](request)
+                job["status"] = "completed"
+            except HTTPException as e:
+                job["error"] = e.detail
+                job["error_code"] = problem_code(e)
+                job["status"] = "failed"
+            except Exception as e:
+                logger.error(f"Job {job_id} failed: {str(e)}")
+                job["error"] = "Internal server error"
+                job["error_code"] = "internal_error"
+                job["status"] = "failed"
+            job["completed_at"] = datetime.now(timezone.utc).isoformat()
+            event = job_events.get(job_id)
+            if event is not None:
+                event.set()
+            if job.get("callback_url"):
+                delivery = asyncio.create_task(deliver_job_webhook(job))
+                webhook_deliveries.add(delivery)
+                delivery.add_done_callback(webhook_deliveries.discard)
+        job_queue.task_done()
 
+# Helper to sign a webhook body with HMAC-SHA256 over "<timestamp>.<body>", so receivers can reject replays
+def sign_webhook(body, timestamp):
+    return hmac.new(WEBHOOK_SECRET.encode(), f"{timestamp}.".encode() + body, hashlib.sha256).hexdigest()
+
+# POST a finished job to its callback URL, retrying with exponential backoff. Returns the number of attempts made,
+# or None if every attempt failed.
+def send_job_webhook(job):
+    body = json.dumps({key: value for key, value in job.items() if key != "callback"}, default=str).encode()
+    for attempt in range(1, WEBHOOK_ATTEMPTS + 1):
+        timestamp = str(int(time.time()))
+        request = urllib.request.Request(
+            job["callback_url"],
+            data=body,
+            method="POST",
+            headers={
+                "Content-Type": "application/json",
+                "X-Request-ID": job["request_id"],
+                "X-OptiVest-Timestamp": timestamp,
+                "X-OptiVest-Signature": f"sha256={sign_webhook(body, timestamp)}"
+            }
+        )
+        try:
+            with urllib.request.urlopen(request, timeout=WEBHOOK_TIMEOUT):
+                return attempt
+        except Exception as e:
+            logger.error(f"Webhook for job {job['id']} failed (attempt {attempt}): {str(e)}")
+            if attempt < WEBHOOK_ATTEMPTS:
+                time.sleep(2 ** attempt)
+    return None
+
+# Deliver a finished job's webhook without holding up the job workers, recording the outcome on the job
+async def deliver_job_webhook(job):
+    attempts = await asyncio.to_thread(send_job_webhook, job)
+    job["callback"] = {"delivered": attempts is not None, "attempts": attempts or WEBHOOK_ATTEMPTS}
+
+
+# Start the background job workers with the app
+@app.on_event("startup")
+async def start_job_workers():
+    global job_queue
+    job_queue = asyncio.Queue()
+    for _ in range(JOB_WORKERS):
+        job_workers.append(asyncio.create_task(run_job_worker()))
+
+# Stop the background work when the app shuts down, after uvicorn has drained in-flight requests. The service is
+# marked not ready, the job workers are stopped, and pending webhook deliveries get a short time to finish.
+@app.on_event("shutdown")
+async def stop_job_workers():
+    service_state["ready"] = False
+    if job_queue is not None and not job_queue.empty():
+        logger.error(f"Shutting down with {job_queue.qsize()} queued jobs not run")
+
+    for worker in job_workers:
+        worker.cancel()
+    await asyncio.gather(*job_workers, return_exceptions=True)
+    job_workers.clear()
+
+    if webhook_deliveries:
+        _, pending = await asyncio.wait(webhook_deliveries, timeout=WEBHOOK_SHUTDOWN_SECONDS)
+        if pending:
+            logger.error(f"Shutting down with {len(pending)} job webhooks undelivered")
+
+# Fit every model's active version on a short synthetic series, so the first requests after a deploy
+# don't pay for loading Stan and statsmodels. Returns the models that warmed up successfully.
+def warm_up_models():
+    dates = get_dates("2020-01-01", "monthly", WARMUP_SERIES_LENGTH)
+    values = [100 + index + 10 * math.sin(index / 2) for index in range(WARMUP_SERIES_LENGTH)]
+
+    warmed_up = []
+    for name in SUPPORTED_MODELS:
+        model_info = model_versions[name][active_model_versions[name]]
+        try:
+            forecast_data(
+                dates, values, "Kenya", 3, False, False, model_name=name, hyperparameters=model_info["hyperparameters"]
+            )
+            warmed_up.append(name)
+        except Exception as e:
+            logger.error(f"Warm-up failed for {name}: {str(e)}")
+    return warmed_up
+
+# Warm up the models before the app starts serving requests, then mark the service ready
+@app.on_event("startup")
+async def warm_up():
+    if WARMUP_ON_STARTUP:
+        started = time.monotonic()
+        service_state["warmed_up_models"] = await asyncio.to_thread(warm_up_models)
+        service_state["warm_up_seconds"] = round(time.monotonic() - started, 2)
+    service_state["ready"] = True
 
 # Async route for FastAPI to handle incoming predictions
 @v1_router.post("/predict")
 async def predict_financials(data: PredictionRequest):
     logger.info("Received prediction request")
+    result = await process_predictions(data)
+    logger.info("Prediction successfully processed")
+    return result
+
+# Async route to forecast a single series on demand
+@v1_router.post("/predictions")
+async def create_prediction(data: SeriesPredictionRequest):
+    logger.info("Received series prediction request")
+    result = await process_series_prediction(data)
+    logger.info("Series prediction successfully processed")
+    return result
+
+# Async route to forecast several series in one round trip
+@v1_router.post("/predictions/batch")
+async def create_batch_predictions(data: BatchPredictionRequest):
+    logger.info("Received batch prediction request")
+    result = await process_batch_predictions(data)
+    logger.info("Batch prediction successfully processed")
+    return result
+
+# Route to list issued predictions, optionally for one symbol and those issued within a date range
+@v1_router.get("/predictions")
+async def list_predictions(symbol: str = None, from_date: str = Query(None, alias="from"), to_date: str = Query(None, alias="to")):
     try:
-        result = await process_predictions(data)
-        logger.info("Prediction successfully processed")
-        return result
+        start = pd.to_datetime(from_date, utc=True) if from_date else None
+        end = pd.to_datetime(to_date, utc=True) if to_date else None
+    except ValueError:
+        raise ApiError(400, "invalid_date", detail="Dates must be in YYYY-MM-DD or ISO 8601 format")
+
+    # A bare end date includes the whole of that day
+    if end is not None and len(to_date) == 10:
+        end += pd.Timedelta(days=1) - pd.Timedelta(microseconds=1)
+
+    predictions = []
+    for prediction in prediction_store.values():
+        created_at = pd.to_datetime(prediction["created_at"])
+        if not can_access(prediction["user_id"]):
+            continue
+        if symbol and prediction["symbol"] != symbol:
+            continue
+        if (start is not None and created_at < start) or (end is not None and created_at > end):
+            continue
+        predictions.append(prediction)
+
+    return {"predictions": sorted(predictions, key=lambda prediction: prediction["created_at"])}
+
+# Route to retrieve a previously issued prediction
+@v1_router.get("/predictions/{prediction_id}")
+async def get_prediction(prediction_id: str):
+    prediction = prediction_store.get(prediction_id)
+    if prediction is None or not can_access(prediction["user_id"]):
+        raise ApiError(404, "prediction_not_found", detail="Prediction not found")
+    return prediction
+
+# Route to mint a one-time ticket for authenticating a WebSocket upgrade as the current user
+@v1_router.post("/ws-ticket", status_code=201)
+async def create_ws_ticket():
+    if not USER_AUTH_ENABLED:
+        raise ApiError(400, "auth_disabled", detail="User authentication is not enabled")
+    if current_user_id.get() is None:
+        raise ApiError(400, "authentication_required", detail="Tickets are only issued to authenticated users")
+    return {"ticket": issue_ws_ticket(current_user_id.get()), "expires_in": WS_TICKET_SECONDS}
+
+# Route to queue a long-running computation, returning a job ID to poll
+@v1_router.post("/jobs", status_code=202)
+async def submit_job(data: JobRequest):
+    if data.type not in JOB_TYPES:
+        raise ApiError(400, "unsupported_job_type", detail=f"Unsupported job type, expected one of: {', '.join(JOB_TYPES)}")
+    if data.type in ADMIN_JOB_TYPES and not has_api_key_scope("admin"):
+        raise ApiError(403, "insufficient_scope", detail=f"{data.type} jobs require an API key with the admin scope")
+    request_model = JOB_TYPES[data.type][0]
+    payload = authorize_payload(request_model, data.payload)
+    try:
+        request = request_model(**payload)
     except Exception as e:
-        logger.error(f"Error in prediction endpoint: {str(e)}")
-        raise HTTPException(status_code=500, detail=str(e))
+        raise ApiError(400, "invalid_job_payload", detail=str(e))
+
+    # Only services may direct callbacks elsewhere, so users can't make the service POST to arbitrary addresses
+    if data.callback_url and not current_api_key.get():
+        raise ApiError(403, "callback_url_not_allowed", detail="Only API key callers may set a callback URL")
+    callback_url = data.callback_url or WEBHOOK_URL
+    if callback_url and not WEBHOOK_SECRET:
+        raise ApiError(400, "webhooks_not_configured", detail="Webhooks require WEBHOOK_SECRET to be configured")
+
+    job = {
+        "id": str(uuid.uuid4()),
+        "type": data.type,
+        "status": "queued",
+        "submitted_at": datetime.now(timezone.utc).isoformat(),
+        "callback_url": callback_url,
+        "user_id": current_user_id.get(),
+        "api_key": current_api_key.get(),
+        "request_id": current_request_id.get()
+    }
+    store_job(job)
+    await job_queue.put((job["id"], request))
+    logger.info(f"Queued {data.type} job {job['id']}")
+    return job
+
+# Route to poll the status of a background job, including its result once completed
+@v1_router.get("/jobs/{job_id}")
+async def get_job(job_id: str):
+    job = job_store.get(job_id)
+    if job is None or not can_access(job["user_id"]):
+        raise ApiError(404, "job_not_found", detail="Job not found")
+    return job
+
+# WebSocket route that sends a background job once it has completed or failed, then closes
+@v1_router.websocket("/jobs/{job_id}/ws")
+async def watch_job(websocket: WebSocket, job_id: str):
+    await websocket.accept()
+    # Keep the job and its event, in case the finished job is evicted while the socket waits
+    job = job_store.get(job_id)
+    event = job_events.get(job_id)
+    if job is None or event is None or not can_access(job["user_id"]):
+        await websocket.send_json(problem_details(404, "job_not_found", "Job not found", websocket.url.path))
+        await websocket.close(code=4404, reason="job_not_found")
+        return
+
+    connection = {
+        "id": str(uuid.uuid4()),
+        "job_id": job_id,
+        "user_id": current_user_id.get(),
+        "api_key": current_api_key.get(),
+        "request_id": current_request_id.get(),
+        "connected_at": datetime.now(timezone.utc).isoformat()
+    }
+    disconnect = asyncio.Event()
+    job_connections[connection["id"]] = (connection, disconnect)
+    waiters = [asyncio.create_task(event.wait()), asyncio.create_task(disconnect.wait())]
+    try:
+        # Wait for the job to finish, unless an admin disconnects the connection first
+        await asyncio.wait(waiters, return_when=asyncio.FIRST_COMPLETED)
+        if disconnect.is_set():
+            await websocket.close(code=status.WS_1008_POLICY_VIOLATION, reason="disconnected_by_admin")
+            return
+        await websocket.send_json(job)
+        await websocket.close()
+    except WebSocketDisconnect:
+        pass
+    finally:
+        for waiter in waiters:
+            waiter.cancel()
+        job_connections.pop(connection["id"], None)
+
+# Async route to project a portfolio's value with Monte Carlo simulation
+@v1_router.post("/portfolio/projection")
+async def get_portfolio_projection(data: PortfolioProjectionRequest):
+    logger.info("Received portfolio projection request")
+    data.user_id = authorize_user(data.user_id)
+    result = await process_portfolio_projection(data)
+    logger.info("Portfolio projection successfully processed")
+    return result
+
+# Async route to compute a portfolio's Value-at-Risk
+@v1_router.post("/risk")
+async def get_risk(data: RiskRequest):
+    logger.info("Received risk request")
+    result = await process_risk(data)
+    logger.info("Risk successfully processed")
+    return result
+
+# Async route to forecast forward volatility per symbol
+@v1_router.post("/volatility")
+async def get_volatility(data: VolatilityRequest):
+    logger.info("Received volatility request")
+    result = await process_volatility(data)
+    logger.info("Volatility successfully processed")
+    return result
+
+# Async route to compute risk-adjusted performance metrics
+@v1_router.post("/metrics")
+async def get_performance_metrics(data: PerformanceMetricsRequest):
+    logger.info("Received performance metrics request")
+    result = await process_performance_metrics(data)
+    logger.info("Performance metrics successfully processed")
+    return result
+
+# Async route to compute a mean-variance optimal allocation
+@v1_router.post("/portfolio/optimize")
+async def get_portfolio_optimization(data: PortfolioOptimizationRequest):
+    logger.info("Received portfolio optimization request")
+    result = await process_portfolio_optimization(data)
+    logger.info("Portfolio optimization successfully processed")
+    return result
+
+# Async route to recommend trades that bring a portfolio back to its target weights
+@v1_router.post("/portfolio/rebalance")
+async def get_rebalance_plan(data: RebalanceRequest):
+    logger.info("Received rebalance request")
+    result = await process_rebalance(data)
+    logger.info("Rebalance successfully processed")
+    return result
+
+# Async route to compute a correlation matrix and diversification score
+@v1_router.post("/portfolio/correlations")
+async def get_correlations(data: CorrelationRequest):
+    logger.info("Received correlation request")
+    result = await process_correlations(data)
+    logger.info("Correlations successfully processed")
+    return result
+
+# Async route to project whether a savings goal will be met
+@v1_router.post("/goals/projection")
+async def get_goal_projection(data: GoalProjectionRequest):
+    logger.info("Received goal projection request")
+    data.user_id = authorize_user(data.user_id)
+    result = await process_goal_projection(data)
+    logger.info("Goal projection successfully processed")
+    return result
+
+# Async route to project retirement readiness
+@v1_router.post("/retirement/projection")
+async def get_retirement_projection(data: RetirementProjectionRequest):
+    logger.info("Received retirement projection request")
+    data.user_id = authorize_user(data.user_id)
+    result = await process_retirement_projection(data)
+    logger.info("Retirement projection successfully processed")
+    return result
+
+# Async route to forecast debt payoff dates
+@v1_router.post("/debts/payoff")
+async def get_debt_payoff(data: DebtPayoffRequest):
+    logger.info("Received debt payoff request")
+    result = await process_debt_payoff(data)
+    logger.info("Debt payoff successfully processed")
+    return result
+
+# Async route to forecast next month's spend per budget category
+@v1_router.post("/budgets/forecast")
+async def get_budget_forecast(data: BudgetForecastRequest):
+    logger.info("Received budget forecast request")
+    result = await process_budget_forecast(data)
+    logger.info("Budget forecast successfully processed")
+    return result
+
+# Route to set a user's calibration profile for projections
+@v1_router.put("/users/{user_id}/calibration")
+async def set_calibration_profile(user_id: str, data: CalibrationProfileRequest):
+    authorize_user(user_id)
+    if data.profile not in CALIBRATION_PROFILES:
+        raise ApiError(400, "unsupported_calibration_profile", detail=f"Unsupported profile, expected one of: {', '.join(CALIBRATION_PROFILES)}")
+
+    calibration = {"profile": data.profile, **CALIBRATION_PROFILES[data.profile]}
+    if data.return_adjustment is not None:
+        calibration["return_adjustment"] = data.return_adjustment
+    if data.volatility_multiplier is not None:
+        if data.volatility_multiplier <= 0:
+            raise ApiError(400, "invalid_volatility_multiplier", detail="Volatility multiplier must be positive")
+        calibration["volatility_multiplier"] = data.volatility_multiplier
+
+    user_calibration_profiles[user_id] = calibration
+    return {"user_id": user_id, **calibration}
+
+# Route to return a user's calibration profile
+@v1_router.get("/users/{user_id}/calibration")
+async def get_calibration_profile(user_id: str):
+    authorize_user(user_id)
+    calibration = user_calibration_profiles.get(user_id)
+    if calibration is None:
+        raise ApiError(404, "calibration_profile_not_found", detail="Calibration profile not found")
+    return {"user_id": user_id, **calibration}
+
+# Route to remove a user's calibration profile, so projections use their own assumptions again
+@v1_router.delete("/users/{user_id}/calibration", status_code=204)
+async def delete_calibration_profile(user_id: str):
+    authorize_user(user_id)
+    if user_calibration_profiles.pop(user_id, None) is None:
+        raise ApiError(404, "calibration_profile_not_found", detail="Calibration profile not found")
+
+# Route to categorize raw transaction descriptions
+@v1_router.post("/transactions/categorize")
+async def categorize_transactions(data: CategorizationRequest):
+    user_id = authorize_user(data.user_id)
+    if user_id is None:
+        raise ApiError(400, "user_id_required", detail="A user ID is required")
+
+    corrections = user_category_corrections.get(user_id, {})
+    return {"categories": [categorize_description(description, corrections) for description in data.descriptions]}
+
+# Route to record a user's correction so future categorizations for them improve
+@v1_router.post("/transactions/categorize/feedback")
+async def record_category_feedback(data: CategoryFeedbackRequest):
+    user_id = authorize_user(data.user_id)
+    if user_id is None:
+        raise ApiError(400, "user_id_required", detail="A user ID is required")
+
+    normalized = normalize_description(data.description)
+    if not normalized:
+        raise ApiError(400, "empty_description", detail="Description has no words to learn from")
+
+    corrections = user_category_corrections.setdefault(user_id, {})
+    corrections.pop(normalized, None)
+    corrections[normalized] = data.category
+    if len(corrections) > MAX_CORRECTIONS_PER_USER:
+        corrections.pop(next(iter(corrections)))
+
+    return {"user_id": user_id, "description": normalized, "category": data.category, "corrections": len(corrections)}
+
+# Async route to forecast near-term cash flow and low-balance warnings
+@v1_router.post("/cashflow/forecast")
+async def get_cash_flow_forecast(data: CashFlowRequest):
+    logger.info("Received cash flow forecast request")
+    result = await process_cash_flow_forecast(data)
+    logger.info("Cash flow forecast successfully processed")
+    return result
+
+# Async route to compare what-if scenarios against a baseline projection
+@v1_router.post("/scenarios")
+async def get_scenarios(data: ScenarioRequest):
+    logger.info("Received scenario request")
+    result = await process_scenarios(data)
+    logger.info("Scenarios successfully processed")
+    return result
+
+# Async route to flag anomalous values in a series
+@v1_router.post("/anomalies")
+async def get_anomalies(data: AnomalyRequest):
+    logger.info("Received anomaly detection request")
+    result = await process_anomalies(data)
+    logger.info("Anomaly detection successfully processed")
+    return result
+
+# Async route to compute technical indicators over a price series
+@v1_router.post("/indicators")
+async def get_indicators(data: IndicatorRequest):
+    logger.info("Received indicator request")
+    result = await process_indicators(data)
+    logger.info("Indicators successfully processed")
+    return result
+
+# Async route to export a training dataset for offline models
+@v1_router.post("/admin/datasets/export")
+async def export_dataset(data: DatasetExportRequest):
+    logger.info("Received dataset export request")
+    result = await process_dataset_export(data)
+    logger.info("Dataset export successfully processed")
+    return result
+
+# Async route to backtest a forecasting model over historical data
+@v1_router.post("/admin/backtest")
+async def backtest_model(data: BacktestRequest):
+    logger.info("Received backtest request")
+    result = await process_backtest(data)
+    logger.info("Backtest successfully processed")
+    return result
+
+# Route to score a prediction against the values that were later realized
+@v1_router.post("/predictions/{prediction_id}/actuals")
+async def record_prediction_actuals(prediction_id: str, data: ActualsRequest):
+    prediction = prediction_store.get(prediction_id)
+    if prediction is None or not can_access(prediction["user_id"]):
+        raise ApiError(404, "prediction_not_found", detail="Prediction not found")
+
+    actuals = {actual.ds: actual.y for actual in data.actuals}
+    evaluation = evaluate_forecast(prediction["predictions"], actuals, prediction["last_value"])
+    if evaluation is None:
+        raise ApiError(400, "no_matching_actuals", detail="No actuals match the predicted dates")
+
+    # Only actuals posted by services with an API key feed drift detection and shadow evaluation
+    evaluation["source"] = "service" if current_api_key.get() else "user"
+    prediction["evaluation"] = evaluation
+    if evaluation["source"] == "service":
+        check_model_drift(prediction["model"], prediction["model_version"])
+
+        # Score the shadow forecast of the same request against the same actuals
+        shadow = shadow_predictions.get(prediction_id)
+        if shadow is not None:
+            shadow["evaluation"] = evaluate_forecast(shadow["predictions"], actuals, prediction["last_value"])
+    return prediction
+
+# Route to report forecast accuracy per model and symbol across the caller's scored predictions.
+# Predictions made with and without sentiment are reported separately, along with the lift from sentiment.
+@v1_router.get("/accuracy")
+async def get_accuracy(symbol: str = None, model: str = None):
+    groups = {}
+    for prediction in prediction_store.values():
+        if "evaluation" not in prediction or not can_access(prediction["user_id"]):
+            continue
+        if (symbol and prediction["symbol"] != symbol) or (model and prediction["model"] != model):
+            continue
+        key = (prediction["model"], prediction["symbol"], prediction.get("uses_sentiment", False))
+        group = groups.setdefault(key, {"predictions": 0, "points": []})
+        group["predictions"] += 1
+        group["points"] += [(point, prediction["last_value"]) for point in prediction["evaluation"]["points"]]
+
+    results = {
+        key: {
+            "model": key[0],
+            "symbol": key[1],
+            "uses_sentiment": key[2],
+            "predictions": group["predictions"],
+            "points": len(group["points"]),
+            **compute_error_metrics(
+                [point["actual"] for point, _ in group["points"]],
+                [point["predicted"] for point, _ in group["points"]],
+                [last_value for _, last_value in group["points"]]
+            )
+        }
+        for key, group in groups.items()
+    }
+
+    # Reduction in error from adding sentiment, where the same model and symbol were also scored without it
+    for (model_name, symbol_name, uses_sentiment), result in results.items():
+        baseline = results.get((model_name, symbol_name, False))
+        if uses_sentiment and baseline:
+            result["sentiment_lift"] = {
+                metric: baseline[metric] - result[metric]
+                for metric in ("mae", "rmse", "mape") if baseline[metric] is not None and result[metric] is not None
+            }
+
+    return list(results.values())
+
+# Route to rank models by their accuracy over their latest scored predictions, per asset class and horizon.
+# Predictions for different symbols are pooled, so models are ranked by scale-free MAPE. Only the caller's
+# predictions scored by a service count, since users can post their own actuals.
+@v1_router.get("/accuracy/leaderboard")
+async def get_accuracy_leaderboard(asset_class: str = None, horizon: int = None, window: int = 50):
+    if window < 1:
+        raise ApiError(400, "invalid_window", detail="Window must be at least 1 prediction")
+
+    groups = {}
+    for prediction in sorted(prediction_store.values(), key=lambda prediction: prediction["created_at"]):
+        if prediction.get("evaluation", {}).get("source") != "service" or not can_access(prediction["user_id"]):
+            continue
+        prediction_asset_class = prediction.get("asset_class", "equity")
+        if (asset_class and prediction_asset_class != asset_class) or (horizon and prediction["horizon"] != horizon):
+            continue
+        key = (prediction_asset_class, prediction["horizon"])
+        groups.setdefault(key, {}).setdefault(prediction["model"], []).append(prediction["evaluation"]["metrics"])
+
+    leaderboards = []
+    for (group_asset_class, group_horizon), models in groups.items():
+        entries = []
+        for model_name, metrics in models.items():
+            metrics = metrics[-window:]
+            mapes = [metric["mape"] for metric in metrics if metric["mape"] is not None]
+            entries.append({
+                "model": model_name,
+                "active_version": active_model_versions.get(model_name),
+                "predictions": len(metrics),
+                "mape": float(np.mean(mapes)) if mapes else None,
+                "direction_hit_rate": float(np.mean([metric["direction_hit_rate"] for metric in metrics]))
+            })
+
+        # Lowest MAPE first, models without a MAPE last
+        entries.sort(key=lambda entry: (entry["mape"] is None, entry["mape"] or 0))
+        for rank, entry in enumerate(entries, start=1):
+            entry["rank"] = rank
+
+        leaderboards.append({"asset_class": group_asset_class, "horizon": group_horizon, "models": entries})
+
+    return sorted(leaderboards, key=lambda leaderboard: (leaderboard["asset_class"], leaderboard["horizon"]))
+
+# Route to list every registered model version and which version is active
+@v1_router.get("/admin/models")
+async def list_models():
+    return {
+        name: {
+            "active_version": active_model_versions[name],
+            "shadow_version": shadow_model_versions.get(name),
+            "versions": list(versions.values())
+        }
+        for name, versions in model_versions.items()
+    }
+
+# Route to register a new version of a supported forecasting model
+@v1_router.post("/admin/models", status_code=201)
+async def register_model_version(data: ModelVersionRequest):
+    if data.name not in SUPPORTED_MODELS:
+        raise ApiError(400, "unsupported_model", detail="Unsupported model")
+    if data.version in model_versions[data.name]:
+        raise ApiError(409, "model_version_exists", detail="Model version already registered")
+    if data.use_sentiment and data.name != "prophet":
+        raise ApiError(400, "sentiment_unsupported", detail="Sentiment is only supported by Prophet")
+    if data.fallback_model is not None and (data.fallback_model not in SUPPORTED_MODELS or data.fallback_model == data.name):
+        raise ApiError(400, "invalid_fallback_model", detail="Fallback model must be a different supported model")
+
+    try:
+        hyperparameters = validate_hyperparameters(data.name, data.hyperparameters)
+    except InputError as e:
+        raise ApiError(e.status_code, e.code, detail=str(e))
+
+    model_info = {
+        "name": data.name,
+        "version": data.version,
+        "asset_classes": data.asset_classes,
+        "hyperparameters": hyperparameters,
+        "artifact_location": data.artifact_location,
+        "use_sentiment": data.use_sentiment,
+        "fallback_model": data.fallback_model,
+        "registered_at": datetime.now(timezone.utc).isoformat()
+    }
+    model_versions[data.name][data.version] = model_info
+    logger.info(f"Registered {data.name} version {data.version}")
+    return model_info
+
+# Async route to tune ensemble weights from the backtest accuracy of each member model
+@v1_router.post("/admin/models/ensemble/tune", status_code=201)
+async def tune_ensemble(data: EnsembleTuningRequest):
+    logger.info("Received ensemble tuning request")
+    result = await process_ensemble_tuning(data)
+    logger.info("Ensemble tuning successfully processed")
+    return result
+
+# Route to issue an API key for a service. The secret is only returned here, only its hash is kept.
+@v1_router.post("/admin/api-keys", status_code=201)
+async def create_api_key(data: ApiKeyRequest):
+    secret = secrets.token_urlsafe(32)
+    try:
+        add_api_key(data.name, secret, data.scopes, data.rate_limit_per_minute)
+    except ValueError as e:
+        raise ApiError(400, "invalid_api_key_request", detail=str(e))
+    logger.info(f"Issued API key {data.name}")
+    return {**api_keys[hash_api_key(secret)], "key": secret}
+
+# Route to list issued API keys without their secrets
+@v1_router.get("/admin/api-keys")
+async def list_api_keys():
+    return list(api_keys.values())
+
+# Route to revoke a service's API key
+@v1_router.delete("/admin/api-keys/{name}", status_code=204)
+async def revoke_api_key(name: str):
+    key_hashes = [key_hash for key_hash, key in api_keys.items() if key["name"] == name]
+    if not key_hashes:
+        raise ApiError(404, "api_key_not_found", detail="API key not found")
+    for key_hash in key_hashes:
+        del api_keys[key_hash]
+    api_key_usage.pop(name, None)
+    logger.info(f"Revoked API key {name}")
+
+# Route to list the open job WebSocket connections and the job queue's depth
+@v1_router.get("/admin/connections")
+async def list_connections():
+    return {
+        "connections": [connection for connection, _ in job_connections.values()],
+        "queued_jobs": job_queue.qsize() if job_queue is not None else 0,
+        "running_jobs": sum(job["status"] == "running" for job in job_store.values())
+    }
+
+# Route to force-disconnect a job WebSocket connection
+@v1_router.delete("/admin/connections/{connection_id}", status_code=204)
+async def disconnect_connection(connection_id: str):
+    if connection_id not in job_connections:
+        raise ApiError(404, "connection_not_found", detail="Connection not found")
+    job_connections[connection_id][1].set()
+    logger.info(f"Disconnected connection {connection_id}")
+
+# Route to make a registered version the default for its model
+@v1_router.post("/admin/models/{name}/versions/{version}/activate")
+async def activate_model_version(name: str, version: str):
+    if version not in model_versions.get(name, {}):
+        raise ApiError(404, "model_version_not_found", detail="Model version not found")
+
+    active_model_versions[name] = version
+    logger.info(f"Activated {name} version {version}")
+    return model_versions[name][version]
+
+# Route to run a registered version in shadow mode next to its model's active version
+@v1_router.post("/admin/models/{name}/versions/{version}/shadow")
+async def shadow_model_version(name: str, version: str):
+    if version not in model_versions.get(name, {}):
+        raise ApiError(404, "model_version_not_found", detail="Model version not found")
+    if version == active_model_versions[name]:
+        raise ApiError(409, "model_version_active", detail="The active version can't run in shadow mode")
+
+    shadow_model_versions[name] = version
+    logger.info(f"Shadowing {name} version {version}")
+    return model_versions[name][version]
+
+# Route to stop running a model's shadow version
+@v1_router.delete("/admin/models/{name}/shadow", status_code=204)
+async def stop_shadow_model_version(name: str):
+    if shadow_model_versions.pop(name, None) is None:
+        raise ApiError(404, "shadow_version_not_found", detail="Model has no shadow version")
+    logger.info(f"Stopped shadowing {name}")
+
+# Route to compare a shadow version's accuracy with the versions that served the same requests, over every
+# prediction scored for both. Errors are pooled over the matched points, as in /v1/accuracy.
+@v1_router.get("/admin/models/{name}/versions/{version}/shadow")
+async def get_shadow_report(name: str, version: str):
+    if version not in model_versions.get(name, {}):
+        raise ApiError(404, "model_version_not_found", detail="Model version not found")
+
+    scored, served_points, shadow_points, served_versions = 0, [], [], set()
+    for prediction_id, shadow in shadow_predictions.items():
+        prediction = prediction_store[prediction_id]
+        if shadow["model"] != name or shadow["model_version"] != version:
+            continue
+        # Users can post their own actuals, so only service scores are compared
+        if prediction.get("evaluation", {}).get("source") != "service" or not shadow.get("evaluation"):
+            continue
+        scored += 1
+        served_versions.add(prediction["model_version"])
+        served_points += [(point, prediction["last_value"]) for point in prediction["evaluation"]["points"]]
+        shadow_points += [(point, prediction["last_value"]) for point in shadow["evaluation"]["points"]]
+
+    def pooled_metrics(points):
+        if not points:
+            return None
+        return compute_error_metrics(
+            [point["actual"] for point, _ in points],
+            [point["predicted"] for point, _ in points],
+            [last_value for _, last_value in points]
+        )
+
+    served, candidate = pooled_metrics(served_points), pooled_metrics(shadow_points)
+    return {
+        "model": name,
+        "candidate_version": version,
+        "served_versions": sorted(served_versions),
+        "predictions": scored,
+        "served": served,
+        "candidate": candidate,
+        # Reduction in error from the candidate, so positive values mean it did better
+        "improvement": {
+            metric: served[metric] - candidate[metric]
+            for metric in ("mae", "rmse", "mape") if served[metric] is not None and candidate[metric] is not None
+        } if served and candidate else None
+    }
+
+# Helper to build a probe response, 200 when every check passes and 503 otherwise
+def probe_response(checks):
+    healthy = all(check["ok"] for check in checks.values())
+    return JSONResponse(
+        status_code=200 if healthy else 503,
+        content={"status": "ok" if healthy else "fail", "checks": checks}
+    )
+
+# Liveness probe: the process is up and its event loop is serving requests
+@app.get("/healthz")
+async def healthz():
+    return probe_response({"event_loop": {"ok": True}})
+
+# Startup probe: the models have been warmed up and the service has finished starting
+@app.get("/startupz")
+async def startupz():
+    return probe_response({
+        "warm_up": {
+            "ok": service_state["ready"],
+            "warmed_up_models": service_state["warmed_up_models"],
+            "seconds": service_state["warm_up_seconds"]
+        }
+    })
+
+# Readiness probe: started up, with the background job workers running to serve queued jobs
+@app.get("/readyz")
+async def readyz():
+    running_workers = sum(not worker.done() for worker in job_workers)
+    return probe_response({
+        "startup": {"ok": service_state["ready"]},
+        "job_workers": {"ok": running_workers == JOB_WORKERS, "running": running_workers, "expected": JOB_WORKERS},
+        "job_queue": {"ok": job_queue is not None, "depth": job_queue.qsize() if job_queue is not None else None}
+    })
+
+# CORS wraps the routes and deprecation middleware, answering preflight requests before authentication
+if CORS_ALLOWED_ORIGINS:
+    if CORS_ALLOW_CREDENTIALS and "*" in CORS_ALLOWED_ORIGINS:
+        raise ValueError("CORS_ALLOW_CREDENTIALS requires explicit CORS_ALLOWED_ORIGINS, not *")
+    app.add_middleware(
+        CORSMiddleware,
+        allow_origins=CORS_ALLOWED_ORIGINS,
+        allow_methods=CORS_ALLOWED_METHODS,
+        allow_headers=CORS_ALLOWED_HEADERS,
+        allow_credentials=CORS_ALLOW_CREDENTIALS,
+        expose_headers=CORS_EXPOSED_HEADERS,
+        max_age=CORS_MAX_AGE
+    )
+
+# Redirect to HTTPS before anything else handles the request
+if HTTPS_REDIRECT:
+    app.add_middleware(HTTPSRedirectMiddleware)
+
+# Plain HTTP listener that only redirects to HTTPS, running while the app serves TLS directly
+http_redirect_server = None
+
+# Answer a plain HTTP request with a 307 to the same URL over HTTPS, then close the connection
+async def redirect_to_https(reader, writer):
+    try:
+        head = await asyncio.wait_for(reader.readuntil(b"\r\n\r\n"), timeout=KEEP_ALIVE_TIMEOUT)
+        request_line, *header_lines = head.decode("latin-1").split("\r\n")
+        headers = {}
+        for line in header_lines:
+            name, _, value = line.partition(":")
+            headers[name.strip().lower()] = value.strip()
+
+        # Without a Host header there is no URL to redirect to
+        hostname = urllib.parse.urlsplit(f"//{headers.get('host', '')}").hostname
+        if not hostname:
+            reply = "HTTP/1.1 400 Bad Request\r\n"
+        else:
+            if ":" in hostname:
+                hostname = f"[{hostname}]"
+            netloc = hostname if SERVER_PORT == 443 else f"{hostname}:{SERVER_PORT}"
+            parts = request_line.split(" ")
+            target = parts[1] if len(parts) == 3 and parts[1].startswith("/") else "/"
+            reply = f"HTTP/1.1 307 Temporary Redirect\r\nLocation: https://{netloc}{target}\r\n"
+
+        writer.write(f"{reply}Content-Length: 0\r\nConnection: close\r\n\r\n".encode("latin-1"))
+        await writer.drain()
+    except (asyncio.TimeoutError, asyncio.IncompleteReadError, asyncio.LimitOverrunError, ConnectionError, ValueError):
+        pass
+    finally:
+        writer.close()
+
+# Start the HTTP redirect listener with the app when it serves TLS itself. Failing to bind the port fails startup.
+@app.on_event("startup")
+async def start_http_redirect():
+    global http_redirect_server
+    if HTTPS_REDIRECT and SSL_CERTFILE:
+        http_redirect_server = await asyncio.start_server(redirect_to_https, SERVER_HOST, HTTP_REDIRECT_PORT)
+        logger.info(f"Redirecting plain HTTP on port {HTTP_REDIRECT_PORT} to HTTPS")
+
+# Stop the HTTP redirect listener when the app shuts down
+@app.on_event("shutdown")
+async def stop_http_redirect():
+    if http_redirect_server is not None:
+        http_redirect_server.close()
+        await http_redirect_server.wait_closed()
+
+# The request ID middleware is outermost, so every response carries a request ID, including CORS preflights
+app.add_middleware(RequestIDMiddleware)
+
+# Include every versioned router in the FastAPI app
+for api_router in api_routers:
+    app.include_router(api_router)
+
+# HTTP server settings. Idle keep-alive connections are closed after KEEP_ALIVE_TIMEOUT seconds, longer than the
+# usual 60 second load balancer idle timeout. Request heads are capped at MAX_HEADER_BYTES, which only h11 enforces,
+# so the server always uses h11 rather than httptools. Connections over MAX_CONNECTIONS get 503. On shutdown,
+# in-flight requests get GRACEFUL_SHUTDOWN_SECONDS to finish.
+SERVER_HOST = os.environ.get("HOST", "0.0.0.0")
+SERVER_PORT = int(os.environ.get("PORT", "8000"))
+SERVER_RELOAD = os.environ.get("SERVER_RELOAD", "false").lower() == "true"
+KEEP_ALIVE_TIMEOUT = int(os.environ.get("KEEP_ALIVE_TIMEOUT", "75"))
+MAX_HEADER_BYTES = int(os.environ.get("MAX_HEADER_BYTES", "16384"))
+MAX_CONNECTIONS = int(os.environ["MAX_CONNECTIONS"]) if os.environ.get("MAX_CONNECTIONS") else None
+GRACEFUL_SHUTDOWN_SECONDS = int(os.environ.get("GRACEFUL_SHUTDOWN_SECONDS", "30"))
 
-# Include the versioned router in the FastAPI app
-app.include_router(v1_router)
+# Serve HTTPS and WSS directly, for deployments without a TLS-terminating proxy, by setting the certificate chain
+# and private key files (PEM). Renewed certificates are picked up on restart.
+SSL_CERTFILE = os.environ.get("SSL_CERTFILE")
+SSL_KEYFILE = os.environ.get("SSL_KEYFILE")
+SSL_KEYFILE_PASSWORD = os.environ.get("SSL_KEYFILE_PASSWORD")
 
-# Run the FastAPI app
+# Run the FastAPI app. uvicorn exits with a non-zero status if the server fails to start, e.g. the port is taken.
 if __name__ == "__main__":
-    uvicorn.run("app:app", host="0.0.0.0", port=8000, reload=True)
+    uvicorn.run(
+        "app:app",
+        host=SERVER_HOST,
+        port=SERVER_PORT,
+        reload=SERVER_RELOAD,
+        timeout_keep_alive=KEEP_ALIVE_TIMEOUT,
+        http="h11",
+        h11_max_incomplete_event_size=MAX_HEADER_BYTES,
+        limit_concurrency=MAX_CONNECTIONS,
+        timeout_graceful_shutdown=GRACEFUL_SHUTDOWN_SECONDS,
+        ssl_certfile=SSL_CERTFILE,
+        ssl_keyfile=SSL_KEYFILE,
+        ssl_keyfile_password=SSL_KEYFILE_PASSWORD
+    )